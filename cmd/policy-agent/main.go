@@ -25,9 +25,30 @@ func main() {
 
 	cfg := config.Load()
 	logger.Info("loaded configuration", lager.Data{
-		"policy_server_url": cfg.PolicyServerURL,
-		"namespace":         cfg.Namespace,
-		"poll_interval":     cfg.PollInterval,
+		"policy_server_url":    cfg.PolicyServerURL,
+		"namespace":            cfg.Namespace,
+		"workload_namespaces":  cfg.WorkloadNamespaces,
+		"poll_interval":        cfg.PollInterval,
+		"reconcile_debounce":   cfg.ReconcileDebounce,
+		"full_resync_interval": cfg.FullResyncInterval,
+		"leader_election":      cfg.LeaderElection,
+		"metrics_bind_address": cfg.MetricsBindAddress,
+		"health_probe_address": cfg.HealthProbeAddress,
+		"sync_stale_threshold": cfg.SyncStaleThreshold,
+		"cache_sync_timeout":   cfg.CacheSyncTimeout,
+		"deletion_guard": lager.Data{
+			"max_count":   cfg.DeletionGuardMaxCount,
+			"max_percent": cfg.DeletionGuardMaxPercent,
+			"passes":      cfg.DeletionGuardPasses,
+		},
+		"clusterwide_global_asgs": cfg.ClusterwideGlobalASGs,
+		"fqdn_destinations":       cfg.FQDNDestinations,
+		"strict_icmp_codes":       cfg.StrictICMPCodes,
+		"c2c_enforcement":         cfg.C2CEnforcement,
+		"write_concurrency":       cfg.WriteConcurrency,
+		"kube_api_qps":            cfg.KubeAPIQPS,
+		"kube_api_burst":          cfg.KubeAPIBurst,
+		"drift_policy":            cfg.DriftPolicy,
 	})
 
 	runtimeManager, err := agent.NewRuntimeManager(ctx, logger, cfg)
@@ -40,8 +61,20 @@ func main() {
 		logger.Fatal("failed to initialize policy server client", err)
 	}
 
-	networkPolicyReconciler := reconciler.New(runtimeManager.KubernetesClient(), cfg, logger)
-	policyAgent := agent.New(runtimeManager.KubernetesClient(), policyClient, networkPolicyReconciler, cfg, logger)
+	networkPolicyReconciler := reconciler.New(runtimeManager.KubernetesClient(), runtimeManager.EventRecorder("policy-agent"), cfg, logger)
+	policyAgent := agent.New(runtimeManager.KubernetesClient(), runtimeManager, policyClient, networkPolicyReconciler, cfg, logger)
+
+	if err := runtimeManager.AddPodEventHandler(policyAgent); err != nil {
+		logger.Fatal("failed to register pod event handler", err)
+	}
+
+	if err := runtimeManager.AddHealthzCheck("sync", policyAgent.HealthzCheck); err != nil {
+		logger.Fatal("failed to add healthz check", err)
+	}
+
+	if err := runtimeManager.AddReadyzCheck("sync", policyAgent.ReadyzCheck); err != nil {
+		logger.Fatal("failed to add readyz check", err)
+	}
 
 	if err := runtimeManager.Add(policyAgent); err != nil {
 		logger.Fatal("failed to add policy agent to manager", err)
@@ -2,111 +2,554 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/reconciler"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
 
 	"code.cloudfoundry.org/lager/v3"
 	policy "code.cloudfoundry.org/policy_client"
 	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 
 	ctrlmanager "sigs.k8s.io/controller-runtime/pkg/manager"
 
 	clnt "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reconcileKey is the only item ever put on the work queue; every pass
+// reconciles the complete state, so queued triggers collapse into one.
+const reconcileKey = "reconcile"
+
+// maxRetryDelay caps the exponential backoff of failed reconciles, which
+// starts at the poll interval.
+const maxRetryDelay = 5 * time.Minute
+
+// PolicyAgent reconciles policies on a periodic resync and whenever the pod
+// informer reports that a space or app GUID appeared in or disappeared from a
+// workload namespace. Only the elected
+// leader runs reconciles, so several replicas never write the same policies.
+type PolicyAgent interface {
+	ctrlmanager.Runnable
+	ctrlmanager.LeaderElectionRunnable
+	toolscache.ResourceEventHandler
+
+	// ReadyzCheck fails until the caches are synced and the first reconcile
+	// succeeded.
+	ReadyzCheck(req *http.Request) error
+	// HealthzCheck fails once the last completed reconcile is older than the
+	// configured staleness threshold.
+	HealthzCheck(req *http.Request) error
+}
+
 type policyAgent struct {
 	k8sclient    clnt.Client
+	cacheSyncer  CacheSyncer
 	policyClient PolicyServerClient
 	reconciler   reconciler.Reconciler
 	config       *config.Config
 	logger       lager.Logger
 	ticker       *time.Ticker
 	ctx          context.Context
+	queue        workqueue.TypedRateLimitingInterface[string]
+
+	workloadsMutex sync.Mutex
+	workloadPods   map[workloadKey]int
+
+	lastSync *syncState
+
+	// unix nanoseconds, zero until the agent is started or has synced. A
+	// completed sync ran through, even if single policies failed.
+	startedAt          atomic.Int64
+	lastSuccessfulSync atomic.Int64
+	lastCompletedSync  atomic.Int64
+
+	cacheSynced       atomic.Bool
+	cacheSyncTimedOut atomic.Bool
 }
 
-var _ ctrlmanager.Runnable = &policyAgent{}
+var _ PolicyAgent = &policyAgent{}
 
-func New(k8sclient clnt.Client, policyClient PolicyServerClient, reconciler reconciler.Reconciler, config *config.Config, logger lager.Logger) ctrlmanager.Runnable {
+func New(k8sclient clnt.Client, cacheSyncer CacheSyncer, policyClient PolicyServerClient, reconciler reconciler.Reconciler, config *config.Config, logger lager.Logger) PolicyAgent {
 	return &policyAgent{
 		k8sclient:    k8sclient,
+		cacheSyncer:  cacheSyncer,
 		policyClient: policyClient,
 		reconciler:   reconciler,
 		config:       config,
 		logger:       logger,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](config.PollInterval, maxRetryDelay),
+			workqueue.TypedRateLimitingQueueConfig[string]{
+				Name: "policy-agent",
+			},
+		),
+		workloadPods: map[workloadKey]int{},
 	}
 }
 
+func (a *policyAgent) NeedLeaderElection() bool {
+	return true
+}
+
 func (a *policyAgent) Start(ctx context.Context) error {
 	a.ctx = ctx
+	a.startedAt.Store(time.Now().UnixNano())
+
+	// reconciling with unsynced caches would observe no space GUIDs and
+	// delete the policies of every space as obsolete
+	if !a.waitForCacheSync() {
+		a.queue.ShutDown()
+		a.logger.Info("policy-agent stopped before caches synced")
+		return nil
+	}
+
 	a.ticker = time.NewTicker(a.config.PollInterval)
 
 	a.logger.Info("policy-agent started", lager.Data{
-		"poll_interval": a.config.PollInterval,
-		"namespace":     a.config.Namespace,
+		"poll_interval":       a.config.PollInterval,
+		"reconcile_debounce":  a.config.ReconcileDebounce,
+		"namespace":           a.config.Namespace,
+		"workload_namespaces": a.config.WorkloadNamespaces,
 	})
 
+	go a.resync()
+
+	a.queue.Add(reconcileKey)
+	for a.processNextItem() {
+	}
+
+	a.ticker.Stop()
+	a.logger.Info("policy-agent stopped")
+	return nil
+}
+
+// waitForCacheSync blocks until the Pod and CiliumNetworkPolicy caches are
+// synced and returns false if the agent is stopped before. Every timeout is
+// logged and reported by the readiness check, but waiting continues.
+func (a *policyAgent) waitForCacheSync() bool {
 	for {
-		a.reconcile()
+		ctx, cancel := context.WithTimeout(a.ctx, a.config.CacheSyncTimeout)
+		synced := a.cacheSyncer.WaitForCacheSync(ctx)
+		cancel()
 
+		if synced {
+			a.cacheSynced.Store(true)
+			return true
+		}
+
+		if a.ctx.Err() != nil {
+			return false
+		}
+
+		a.cacheSyncTimedOut.Store(true)
+		a.logger.Error("timed out waiting for caches to sync", context.DeadlineExceeded, lager.Data{
+			"timeout": a.config.CacheSyncTimeout,
+		})
+	}
+}
+
+// resync enqueues a reconcile on every tick and shuts the queue down once the
+// agent is stopped. Ticks are ignored while a failed reconcile is backing off,
+// which only passes failing as a whole do, e.g. while the policy server is
+// unavailable. Policies failing on their own are retried on the next tick.
+func (a *policyAgent) resync() {
+	for {
 		select {
 		case <-a.ticker.C:
-			continue
+			if a.queue.NumRequeues(reconcileKey) > 0 {
+				continue
+			}
+			a.queue.Add(reconcileKey)
 		case <-a.ctx.Done():
-			a.ticker.Stop()
-			a.logger.Info("policy-agent stopped")
-			return nil
+			a.queue.ShutDown()
+			return
+		}
+	}
+}
+
+func (a *policyAgent) processNextItem() bool {
+	key, shutdown := a.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer a.queue.Done(key)
+
+	if a.ctx.Err() != nil {
+		return false
+	}
+
+	if err := a.reconcile(); !passCompleted(err) {
+		a.logger.Info("reconcile failed, retrying with backoff", lager.Data{
+			"retries": a.queue.NumRequeues(key),
+		})
+		a.queue.AddRateLimited(key)
+		return true
+	}
+
+	a.queue.Forget(key)
+	return true
+}
+
+func (a *policyAgent) OnAdd(obj any, _ bool) {
+	for _, key := range workloadKeysOf(obj) {
+		a.trackWorkload(key, 1)
+	}
+}
+
+func (a *policyAgent) OnUpdate(oldObj, newObj any) {
+	oldKeys := workloadKeysOf(oldObj)
+	newKeys := workloadKeysOf(newObj)
+	if slices.Equal(oldKeys, newKeys) {
+		return
+	}
+
+	for _, key := range oldKeys {
+		a.trackWorkload(key, -1)
+	}
+	for _, key := range newKeys {
+		a.trackWorkload(key, 1)
+	}
+}
+
+func (a *policyAgent) OnDelete(obj any) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	for _, key := range workloadKeysOf(obj) {
+		a.trackWorkload(key, -1)
+	}
+}
+
+// workloadKey identifies a space or app GUID label value in a namespace.
+type workloadKey struct {
+	namespace string
+	label     string
+	guid      string
+}
+
+// trackWorkload updates the number of known pods of a space or app in a
+// namespace and enqueues a debounced reconcile when it is seen there for the
+// first time or its last pod there is gone. Like ticks, workload changes are
+// ignored while a pass which failed as a whole is backing off, its retry
+// observes them.
+func (a *policyAgent) trackWorkload(key workloadKey, delta int) {
+	a.workloadsMutex.Lock()
+	before := a.workloadPods[key]
+	after := max(before+delta, 0)
+	if after == 0 {
+		delete(a.workloadPods, key)
+	} else {
+		a.workloadPods[key] = after
+	}
+	a.workloadsMutex.Unlock()
+
+	if (before == 0) != (after == 0) {
+		if a.queue.NumRequeues(reconcileKey) > 0 {
+			return
+		}
+
+		a.logger.Debug("workload changed, scheduling reconcile", lager.Data{
+			"namespace": key.namespace,
+			"label":     key.label,
+			"guid":      key.guid,
+			"pods":      after,
+		})
+		a.queue.AddAfter(reconcileKey, a.config.ReconcileDebounce)
+	}
+}
+
+func workloadKeysOf(obj any) []workloadKey {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+
+	var keys []workloadKey
+	for _, label := range []string{types.SpaceGUIDLabelKey, types.AppGUIDLabelKey} {
+		if guid, exists := pod.GetLabels()[label]; exists {
+			keys = append(keys, workloadKey{namespace: pod.Namespace, label: label, guid: guid})
 		}
 	}
+	return keys
+}
+
+// syncState remembers the inputs of the last successful reconcile so that
+// passes without any upstream change can be skipped.
+type syncState struct {
+	workloads                 reconciler.Workloads
+	spaceGUIDs                []string
+	securityGroupsLastUpdated time.Time
+	securityGroups            []policy.SecurityGroup
+	policiesLastUpdated       int
+	policiesFetchedAt         time.Time
+	policies                  []*policy.Policy
+	lastFullSync              time.Time
+	// set if single policies failed, which the next pass retries even if
+	// nothing changed
+	failedPolicies bool
+}
+
+func (a *policyAgent) reconcile() error {
+	start := time.Now()
+	skipped, err := a.sync()
+
+	result := metrics.ResultSuccess
+	switch {
+	case err != nil:
+		result = metrics.ResultError
+	case skipped:
+		result = metrics.ResultSkipped
+	}
+
+	metrics.ReconcileDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if err == nil {
+		a.lastSuccessfulSync.Store(time.Now().UnixNano())
+		metrics.LastSuccessfulReconcile.SetToCurrentTime()
+	}
+	if passCompleted(err) {
+		a.lastCompletedSync.Store(time.Now().UnixNano())
+	}
+	return err
+}
+
+// ReadyzCheck reports standby replicas, which never reconcile while another
+// replica holds the leader lease, as ready.
+func (a *policyAgent) ReadyzCheck(_ *http.Request) error {
+	if a.startedAt.Load() == 0 {
+		return nil
+	}
+
+	if !a.cacheSynced.Load() {
+		if a.cacheSyncTimedOut.Load() {
+			return fmt.Errorf("caches not synced within %s", a.config.CacheSyncTimeout)
+		}
+		return errors.New("waiting for caches to sync")
+	}
+
+	if a.lastSuccessfulSync.Load() == 0 {
+		return errors.New("waiting for first successful sync")
+	}
+
+	return nil
 }
 
-func (a *policyAgent) reconcile() {
-	policies, err := a.policyClient.GetPolicies()
+// HealthzCheck measures staleness from the start of the agent until the first
+// reconcile completed. Single failing policies do not fail the liveness
+// check, restarting the agent would not make the API server accept them. They
+// are reported by the status ConfigMap and the failed operations metric.
+func (a *policyAgent) HealthzCheck(_ *http.Request) error {
+	startedAt := a.startedAt.Load()
+	if startedAt == 0 {
+		return nil
+	}
+
+	lastSync := time.Unix(0, max(a.lastCompletedSync.Load(), startedAt))
+	if since := time.Since(lastSync); since > a.config.SyncStaleThreshold {
+		return fmt.Errorf("last completed sync was %s ago, exceeding threshold of %s", since.Round(time.Second), a.config.SyncStaleThreshold)
+	}
+
+	return nil
+}
+
+// sync fetches the current state from the policy server and reconciles it,
+// unless nothing changed since the last successful pass.
+func (a *policyAgent) sync() (bool, error) {
+	workloads, err := a.observedWorkloads()
 	if err != nil {
-		a.logger.Error("error fetching policies", err, lager.Data{
+		return false, err
+	}
+	spaceGUIDs := workloads.SpaceGUIDs()
+
+	securityGroupsLastUpdated, err := a.policyClient.GetSecurityGroupsLastUpdatedTimestamp()
+	if err != nil {
+		a.logger.Error("error fetching security groups last updated timestamp", err, lager.Data{
 			"policy_server_url": a.config.PolicyServerURL,
 		})
-		return
+		return false, err
 	}
 
-	securityGroups, err := a.fetchSecurityGroups()
+	policiesLastUpdated, err := a.policyClient.GetPoliciesLastUpdated()
 	if err != nil {
-		a.logger.Error("error fetching security groups", err, lager.Data{
+		a.logger.Error("error fetching policies last updated timestamp", err, lager.Data{
 			"policy_server_url": a.config.PolicyServerURL,
 		})
-		return
+		return false, err
+	}
+
+	last := a.lastSync
+	fullSync := last == nil || time.Since(last.lastFullSync) >= a.config.FullResyncInterval
+	securityGroupsChanged := fullSync ||
+		!securityGroupsLastUpdated.Equal(last.securityGroupsLastUpdated) ||
+		!slices.Equal(spaceGUIDs, last.spaceGUIDs)
+	// the timestamp has a resolution of seconds, so policies which were last
+	// updated in the second they were fetched may have changed since
+	policiesChanged := fullSync || policiesLastUpdated != last.policiesLastUpdated ||
+		int64(policiesLastUpdated) >= last.policiesFetchedAt.Unix()
+	// apps moving between namespaces change where policies are rendered
+	// without changing anything on the policy server
+	workloadsChanged := fullSync || !workloads.Equal(last.workloads)
+
+	if !securityGroupsChanged && !policiesChanged && !workloadsChanged && !last.failedPolicies {
+		a.logger.Debug("no changes since last sync, skipping reconcile", lager.Data{
+			"security_groups_last_updated": securityGroupsLastUpdated,
+			"policies_last_updated":        policiesLastUpdated,
+			"space_guids":                  len(spaceGUIDs),
+		})
+		return true, nil
 	}
 
-	if err := a.reconciler.Reconcile(securityGroups, policies); err != nil {
+	// the previous sync state is only reused after a successful pass, a failed
+	// pass always forces the next one to fetch everything again
+	a.lastSync = nil
+
+	policies, policiesFetchedAt := last.cachedPolicies()
+	if policiesChanged {
+		policiesFetchedAt = time.Now()
+		policies, err = a.policyClient.GetPolicies()
+		if err != nil {
+			a.logger.Error("error fetching policies", err, lager.Data{
+				"policy_server_url": a.config.PolicyServerURL,
+			})
+			return false, err
+		}
+	}
+
+	securityGroups := last.cachedSecurityGroups()
+	if securityGroupsChanged {
+		securityGroups, err = a.policyClient.GetSecurityGroupsForSpace(spaceGUIDs...)
+		if err != nil {
+			a.logger.Error("error fetching security groups", err, lager.Data{
+				"policy_server_url": a.config.PolicyServerURL,
+			})
+			return false, err
+		}
+	}
+
+	metrics.Spaces.Set(float64(len(spaceGUIDs)))
+	metrics.SecurityGroups.Set(float64(len(securityGroups)))
+	metrics.C2CPolicies.Set(float64(len(policies)))
+
+	// only passes with fresh policy server data count towards the deletion
+	// guard
+	var opts []reconciler.ReconcileOption
+	if !securityGroupsChanged || !policiesChanged {
+		opts = append(opts, reconciler.WithCachedData())
+	}
+
+	err = a.reconciler.Reconcile(securityGroups, policies, workloads, opts...)
+	if onlyDeletionsWithheld(err) {
+		// a withheld deletion is a successful but degraded pass, reported by
+		// the deletion guard through its metric, event and the status
+		// ConfigMap. The sync state is not kept, so that the passes counted
+		// by the guard fetch fresh data from the policy server.
+		a.logger.Info("reconciled with deletions withheld by the deletion guard", lager.Data{"reason": err.Error()})
+		return false, nil
+	}
+	if !passCompleted(err) {
 		a.logger.Error("error reconciling security groups", err)
+		return false, err
 	}
-}
 
-func (a *policyAgent) fetchSecurityGroups() ([]policy.SecurityGroup, error) {
-	pods := &corev1.PodList{}
-	if err := a.k8sclient.List(context.Background(), pods); err != nil {
-		a.logger.Error("error listing pods", err)
-		return nil, err
+	lastFullSync := time.Now()
+	if !fullSync {
+		lastFullSync = last.lastFullSync
 	}
 
-	spaceGUIDSet := map[string]struct{}{}
-	for _, pod := range pods.Items {
-		if label, exists := pod.GetLabels()[types.SpaceGUIDLabelKey]; exists {
-			spaceGUIDSet[label] = struct{}{}
+	// single failed policies do not fail the pass as a whole, they are
+	// retried on the next tick without fetching unchanged data again
+	if !errors.Is(err, reconciler.ErrDeletionsWithheld) {
+		a.lastSync = &syncState{
+			workloads:                 workloads,
+			spaceGUIDs:                spaceGUIDs,
+			securityGroupsLastUpdated: securityGroupsLastUpdated,
+			securityGroups:            securityGroups,
+			policiesLastUpdated:       policiesLastUpdated,
+			policiesFetchedAt:         policiesFetchedAt,
+			policies:                  policies,
+			lastFullSync:              lastFullSync,
+			failedPolicies:            err != nil,
 		}
 	}
+	if err != nil {
+		a.logger.Error("reconciled with failed policies, retrying them on the next tick", err)
+	}
+
+	return false, err
+}
 
-	spaceGUIDs := []string{}
-	for guid := range spaceGUIDSet {
-		spaceGUIDs = append(spaceGUIDs, guid)
+// onlyDeletionsWithheld reports whether the deletion guard withholding
+// deletions is the only error of a reconcile.
+func onlyDeletionsWithheld(err error) bool {
+	return err != nil && onlyErrors(err, reconciler.ErrDeletionsWithheld)
+}
+
+// passCompleted reports whether a reconcile ran through, even if single
+// policies failed or their deletion was withheld.
+func passCompleted(err error) bool {
+	return err == nil || onlyErrors(err, reconciler.ErrDeletionsWithheld, reconciler.ErrPolicyFailed)
+}
+
+// onlyErrors reports whether every error joined into err matches one of the
+// targets.
+func onlyErrors(err error, targets ...error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if !onlyErrors(err, targets...) {
+				return false
+			}
+		}
+		return true
+	}
+	return slices.ContainsFunc(targets, func(target error) bool {
+		return errors.Is(err, target)
+	})
+}
+
+func (s *syncState) cachedPolicies() ([]*policy.Policy, time.Time) {
+	if s == nil {
+		return nil, time.Time{}
 	}
+	return s.policies, s.policiesFetchedAt
+}
+
+func (s *syncState) cachedSecurityGroups() []policy.SecurityGroup {
+	if s == nil {
+		return nil
+	}
+	return s.securityGroups
+}
+
+// observedWorkloads returns the space and app GUIDs of all CF pods in the
+// workload namespaces.
+func (a *policyAgent) observedWorkloads() (reconciler.Workloads, error) {
+	var pods []corev1.Pod
+	for _, namespace := range a.config.WorkloadNamespaces {
+		namespacePods := &corev1.PodList{}
+		if err := a.k8sclient.List(context.Background(), namespacePods, clnt.InNamespace(namespace)); err != nil {
+			a.logger.Error("error listing pods", err, lager.Data{"namespace": namespace})
+			return reconciler.Workloads{}, err
+		}
+		pods = append(pods, namespacePods.Items...)
+	}
+
+	workloads := reconciler.NewWorkloads(pods)
 
 	a.logger.Info("checking pods", lager.Data{
-		"count":       len(pods.Items),
-		"space_guids": len(spaceGUIDs),
+		"count":       len(pods),
+		"namespaces":  len(a.config.WorkloadNamespaces),
+		"space_guids": len(workloads.SpaceGUIDs()),
 	})
 
-	return a.policyClient.GetSecurityGroupsForSpace(spaceGUIDs...)
+	return workloads, nil
 }
@@ -2,12 +2,16 @@ package agent_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/agent"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/agent/agentfakes"
 	agentconfig "code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/reconciler"
 
 	policy "code.cloudfoundry.org/policy_client"
@@ -15,16 +19,20 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 
 	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
 	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/events"
 
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
-	ctrlmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 func init() {
@@ -38,11 +46,12 @@ var _ = Describe("Agent", func() {
 
 		ctx                context.Context
 		cancel             context.CancelFunc
-		policyAgent        ctrlmanager.Runnable
+		policyAgent        agent.PolicyAgent
 		fakePolicyClient   *agentfakes.FakePolicyServerClient
 		fakeReconciler     reconciler.Reconciler
 		fakeClient         ctrlclient.Client
 		fakeRuntimeManager *agentfakes.FakeRuntimeManager
+		fakeCacheSyncer    *agentfakes.FakeCacheSyncer
 	)
 
 	BeforeEach(func() {
@@ -50,8 +59,9 @@ var _ = Describe("Agent", func() {
 		logger.RegisterSink(lager.NewWriterSink(io.Discard, lager.DEBUG))
 
 		config = &agentconfig.Config{
-			Namespace:    "default",
-			PollInterval: 1 * time.Second,
+			Namespace:          "default",
+			WorkloadNamespaces: []string{"default"},
+			PollInterval:       1 * time.Second,
 		}
 
 		fakePolicyClient = &agentfakes.FakePolicyServerClient{}
@@ -60,7 +70,10 @@ var _ = Describe("Agent", func() {
 		fakeRuntimeManager = &agentfakes.FakeRuntimeManager{}
 		fakeRuntimeManager.KubernetesClientReturns(fakeClient)
 
-		fakeReconciler = reconciler.New(fakeClient, config, logger)
+		fakeCacheSyncer = &agentfakes.FakeCacheSyncer{}
+		fakeCacheSyncer.WaitForCacheSyncReturns(true)
+
+		fakeReconciler = reconciler.New(fakeClient, &events.FakeRecorder{}, config, logger)
 		ctx, cancel = context.WithCancel(context.Background())
 	})
 
@@ -68,6 +81,13 @@ var _ = Describe("Agent", func() {
 		cancel()
 	})
 
+	Describe("NeedLeaderElection", func() {
+		It("requires leader election", func() {
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
+			Expect(policyAgent.NeedLeaderElection()).To(BeTrue())
+		})
+	})
+
 	Describe("Start", func() {
 		It("processes security groups and C2C policies", func() {
 			fakePolicyClient.GetPoliciesReturns([]*policy.Policy{
@@ -103,12 +123,13 @@ var _ = Describe("Agent", func() {
 					Namespace: config.Namespace,
 					Labels: map[string]string{
 						"cloudfoundry.org/space-guid": "test-space-guid-123",
+						"cloudfoundry.org/app-guid":   "app-guid-1",
 					},
 				},
 			}
 			Expect(fakeClient.Create(context.Background(), testPod)).To(Succeed())
 
-			policyAgent = agent.New(fakeClient, fakePolicyClient, fakeReconciler, config, logger)
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
 
 			agentDone := make(chan struct{})
 			go func() {
@@ -131,4 +152,434 @@ var _ = Describe("Agent", func() {
 			<-agentDone
 		})
 	})
+
+	Describe("pod events", func() {
+		var agentDone chan struct{}
+
+		podInSpace := func(name, spaceGUID string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: config.Namespace,
+					Labels: map[string]string{
+						"cloudfoundry.org/space-guid": spaceGUID,
+					},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			config.PollInterval = time.Hour
+			config.ReconcileDebounce = 10 * time.Millisecond
+
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
+
+			agentDone = make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(policyAgent.Start(ctx)).To(Succeed())
+				close(agentDone)
+			}()
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(1))
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(agentDone).Should(BeClosed())
+		})
+
+		It("reconciles when a pod of a new space is added", func() {
+			policyAgent.OnAdd(podInSpace("pod-1", "space-1"), false)
+
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+		})
+
+		It("does not reconcile when a pod of a known space is added", func() {
+			policyAgent.OnAdd(podInSpace("pod-1", "space-1"), false)
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+
+			policyAgent.OnAdd(podInSpace("pod-2", "space-1"), false)
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "200ms").Should(Equal(2))
+		})
+
+		It("reconciles when the last pod of a space is deleted", func() {
+			policyAgent.OnAdd(podInSpace("pod-1", "space-1"), false)
+			policyAgent.OnAdd(podInSpace("pod-2", "space-1"), false)
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+
+			policyAgent.OnDelete(podInSpace("pod-1", "space-1"))
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "200ms").Should(Equal(2))
+
+			policyAgent.OnDelete(toolscache.DeletedFinalStateUnknown{
+				Key: "default/pod-2",
+				Obj: podInSpace("pod-2", "space-1"),
+			})
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(3))
+		})
+
+		It("reconciles when a pod moves to a new space", func() {
+			policyAgent.OnAdd(podInSpace("pod-1", "space-1"), false)
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+
+			policyAgent.OnUpdate(podInSpace("pod-1", "space-1"), podInSpace("pod-1", "space-2"))
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(3))
+		})
+
+		It("does not bypass the backoff of a failed reconcile", func() {
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Time{}, errors.New("policy server unavailable"))
+			policyAgent.OnAdd(podInSpace("pod-1", "space-1"), false)
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+
+			for i := 2; i < 6; i++ {
+				time.Sleep(2 * config.ReconcileDebounce)
+				policyAgent.OnAdd(podInSpace(fmt.Sprintf("pod-%d", i), fmt.Sprintf("space-%d", i)), false)
+			}
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "100ms").Should(Equal(2))
+		})
+
+		It("debounces bursts of pod events into a single reconcile", func() {
+			for i := range 10 {
+				policyAgent.OnAdd(podInSpace(fmt.Sprintf("pod-%d", i), fmt.Sprintf("space-%d", i)), false)
+			}
+
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(Equal(2))
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "200ms").Should(Equal(2))
+		})
+	})
+
+	Describe("change detection", func() {
+		var agentDone chan struct{}
+
+		startAgent := func() {
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
+
+			agentDone = make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(policyAgent.Start(ctx)).To(Succeed())
+				close(agentDone)
+			}()
+		}
+
+		BeforeEach(func() {
+			config.PollInterval = 10 * time.Millisecond
+			config.FullResyncInterval = time.Hour
+
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Unix(100, 0), nil)
+			fakePolicyClient.GetPoliciesLastUpdatedReturns(100, nil)
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(agentDone).Should(BeClosed())
+		})
+
+		It("skips fetching and reconciling when nothing changed", func() {
+			startAgent()
+
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount).Should(BeNumerically(">=", 3))
+			Expect(fakePolicyClient.GetPoliciesCallCount()).To(Equal(1))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(Equal(1))
+			Expect(testutil.ToFloat64(metrics.LastSuccessfulReconcile)).To(BeNumerically(">", 0))
+		})
+
+		It("fetches security groups when their last updated timestamp changes", func() {
+			startAgent()
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(1))
+
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Unix(200, 0), nil)
+
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(2))
+			Consistently(fakePolicyClient.GetSecurityGroupsForSpaceCallCount, "100ms").Should(Equal(2))
+			Expect(fakePolicyClient.GetPoliciesCallCount()).To(Equal(1))
+		})
+
+		It("fetches security groups when a new space is observed", func() {
+			startAgent()
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(1))
+
+			Expect(fakeClient.Create(context.Background(), &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "new-pod",
+					Namespace: config.Namespace,
+					Labels: map[string]string{
+						"cloudfoundry.org/space-guid": "new-space-guid",
+					},
+				},
+			})).To(Succeed())
+
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(2))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceArgsForCall(1)).To(ConsistOf("new-space-guid"))
+			Expect(fakePolicyClient.GetPoliciesCallCount()).To(Equal(1))
+		})
+
+		It("reconciles without fetching when an app starts in another workload namespace", func() {
+			config.WorkloadNamespaces = []string{"default", "other"}
+			fakePolicyClient.GetPoliciesReturns([]*policy.Policy{{
+				Source:      policy.Source{ID: "app-guid-1"},
+				Destination: policy.Destination{ID: "app-guid-2", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+			}}, nil)
+
+			appPod := func(namespace string) *corev1.Pod {
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "app-pod",
+						Namespace: namespace,
+						Labels: map[string]string{
+							"cloudfoundry.org/space-guid": "space-guid",
+							"cloudfoundry.org/app-guid":   "app-guid-1",
+						},
+					},
+				}
+			}
+			Expect(fakeClient.Create(context.Background(), appPod("default"))).To(Succeed())
+
+			startAgent()
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(1))
+
+			Expect(fakeClient.Create(context.Background(), appPod("other"))).To(Succeed())
+
+			Eventually(func() error {
+				return fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "c2c-app-guid-1", Namespace: "other"}, &ciliumv2.CiliumNetworkPolicy{})
+			}).Should(Succeed())
+			Expect(fakePolicyClient.GetPoliciesCallCount()).To(Equal(1))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(Equal(1))
+		})
+
+		It("fetches policies when their last updated timestamp changes", func() {
+			startAgent()
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(Equal(1))
+
+			fakePolicyClient.GetPoliciesLastUpdatedReturns(200, nil)
+
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(Equal(2))
+			Consistently(fakePolicyClient.GetPoliciesCallCount, "100ms").Should(Equal(2))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(Equal(1))
+		})
+
+		It("fetches policies again if they were last updated in the second they were fetched", func() {
+			fakePolicyClient.GetPoliciesLastUpdatedReturns(int(time.Now().Unix()), nil)
+			startAgent()
+
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(BeNumerically(">=", 2))
+
+			// once fetched in a later second, the policies are up to date
+			Eventually(func() int {
+				calls := fakePolicyClient.GetPoliciesCallCount()
+				time.Sleep(100 * time.Millisecond)
+				return fakePolicyClient.GetPoliciesCallCount() - calls
+			}, "3s").Should(BeZero())
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(Equal(1))
+		})
+
+		It("forces a full resync once the resync interval has passed", func() {
+			config.FullResyncInterval = 50 * time.Millisecond
+			startAgent()
+
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(BeNumerically(">=", 2))
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(BeNumerically(">=", 2))
+		})
+
+		It("fetches everything again after a failed pass", func() {
+			fakePolicyClient.GetSecurityGroupsForSpaceReturnsOnCall(0, nil, errors.New("policy server unavailable"))
+			startAgent()
+
+			Eventually(fakePolicyClient.GetSecurityGroupsForSpaceCallCount).Should(Equal(2))
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(Equal(2))
+		})
+
+		It("treats passes withholding deletions as successful and fetches fresh data for each of them", func() {
+			config.DeletionGuardMaxPercent = 50
+			config.DeletionGuardPasses = 20
+			for _, name := range []string{"asg-1", "asg-2"} {
+				Expect(fakeClient.Create(context.Background(), &ciliumv2.CiliumNetworkPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: config.Namespace,
+						Labels:    map[string]string{"app": "policy-agent"},
+					},
+				})).To(Succeed())
+			}
+			fakeReconciler = reconciler.New(fakeClient, &events.FakeRecorder{}, config, logger)
+			startAgent()
+
+			policies := func() []ciliumv2.CiliumNetworkPolicy {
+				list := &ciliumv2.CiliumNetworkPolicyList{}
+				Expect(fakeClient.List(context.Background(), list)).To(Succeed())
+				return list.Items
+			}
+
+			Eventually(func() error { return policyAgent.ReadyzCheck(nil) }).Should(Succeed())
+			Expect(policyAgent.HealthzCheck(nil)).To(Succeed())
+			Expect(policies()).To(HaveLen(2))
+
+			Eventually(policies, "2s").Should(BeEmpty())
+			Expect(fakePolicyClient.GetPoliciesCallCount()).To(BeNumerically(">=", 20))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(BeNumerically(">=", 20))
+		})
+
+		It("retries single failing policies on every tick while the others keep converging", func() {
+			var rejected atomic.Int32
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					if obj.(metav1.Object).GetName() == "rejected" {
+						rejected.Add(1)
+						return errors.New("denied by admission webhook")
+					}
+					return c.Apply(ctx, obj, opts...)
+				},
+			}).Build()
+			fakeReconciler = reconciler.New(fakeClient, &events.FakeRecorder{}, config, logger)
+
+			rules := []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}}
+			asgs := []policy.SecurityGroup{
+				{Guid: "rejected", Name: "rejected", RunningDefault: true, Rules: rules},
+				{Guid: "healthy", Name: "healthy", RunningDefault: true, Rules: rules},
+			}
+			fakePolicyClient.GetSecurityGroupsForSpaceReturns(asgs, nil)
+			startAgent()
+
+			cnp := func(name string) func() error {
+				return func() error {
+					return fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: name, Namespace: config.Namespace}, &ciliumv2.CiliumNetworkPolicy{})
+				}
+			}
+			Eventually(cnp("healthy")).Should(Succeed())
+
+			// a backoff of 10ms, 20ms, 40ms, ... would give ~7 attempts
+			Eventually(rejected.Load, "1s").Should(BeNumerically(">=", 20))
+			Expect(fakePolicyClient.GetSecurityGroupsForSpaceCallCount()).To(Equal(1))
+
+			fakePolicyClient.GetSecurityGroupsForSpaceReturns(append(asgs, policy.SecurityGroup{Guid: "new", Name: "new", RunningDefault: true, Rules: rules}), nil)
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Unix(200, 0), nil)
+			Eventually(cnp("new"), "200ms").Should(Succeed())
+		})
+
+		It("retries failed passes with exponential backoff instead of on every tick", func() {
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Time{}, errors.New("policy server unavailable"))
+			startAgent()
+
+			// ticks every 10ms would give ~40 attempts, a backoff of 10ms, 20ms, 40ms, ... gives ~6
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "400ms").Should(BeNumerically("<=", 8))
+
+			fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampReturns(time.Unix(100, 0), nil)
+			Eventually(func() error { return policyAgent.ReadyzCheck(nil) }, "2s").Should(Succeed())
+
+			calls := fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount()
+			Eventually(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "100ms").Should(BeNumerically(">=", calls+3))
+		})
+	})
+
+	Describe("health checks", func() {
+		var agentDone chan struct{}
+
+		startAgent := func() {
+			agentDone = make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(policyAgent.Start(ctx)).To(Succeed())
+				close(agentDone)
+			}()
+		}
+
+		BeforeEach(func() {
+			config.PollInterval = 10 * time.Millisecond
+			config.SyncStaleThreshold = time.Hour
+
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
+		})
+
+		AfterEach(func() {
+			if agentDone != nil {
+				cancel()
+				Eventually(agentDone).Should(BeClosed())
+			}
+		})
+
+		It("reports a standby agent as ready and healthy", func() {
+			Expect(policyAgent.ReadyzCheck(nil)).To(Succeed())
+			Expect(policyAgent.HealthzCheck(nil)).To(Succeed())
+		})
+
+		It("becomes ready after the first successful sync", func() {
+			startAgent()
+
+			Eventually(func() error { return policyAgent.ReadyzCheck(nil) }).Should(Succeed())
+			Expect(policyAgent.HealthzCheck(nil)).To(Succeed())
+		})
+
+		It("does not reconcile before the caches are synced", func() {
+			cachesSynced := make(chan struct{})
+			fakeCacheSyncer.WaitForCacheSyncStub = func(ctx context.Context) bool {
+				select {
+				case <-cachesSynced:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+			config.CacheSyncTimeout = time.Hour
+			startAgent()
+
+			Consistently(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount, "100ms").Should(BeZero())
+			Expect(policyAgent.ReadyzCheck(nil)).To(MatchError("waiting for caches to sync"))
+
+			close(cachesSynced)
+			Eventually(func() error { return policyAgent.ReadyzCheck(nil) }).Should(Succeed())
+		})
+
+		It("is not ready once waiting for the caches timed out", func() {
+			fakeCacheSyncer.WaitForCacheSyncStub = func(ctx context.Context) bool {
+				<-ctx.Done()
+				return false
+			}
+			config.CacheSyncTimeout = 10 * time.Millisecond
+			startAgent()
+
+			Eventually(func() error { return policyAgent.ReadyzCheck(nil) }).Should(MatchError("caches not synced within 10ms"))
+			Eventually(fakeCacheSyncer.WaitForCacheSyncCallCount).Should(BeNumerically(">=", 2))
+			Expect(fakePolicyClient.GetSecurityGroupsLastUpdatedTimestampCallCount()).To(BeZero())
+		})
+
+		It("is not ready while every sync fails", func() {
+			fakePolicyClient.GetPoliciesReturns(nil, errors.New("policy server unavailable"))
+			startAgent()
+
+			Eventually(fakePolicyClient.GetPoliciesCallCount).Should(BeNumerically(">=", 2))
+			Expect(policyAgent.ReadyzCheck(nil)).To(MatchError(ContainSubstring("first successful sync")))
+		})
+
+		It("fails the liveness check once syncs are stale", func() {
+			config.SyncStaleThreshold = 100 * time.Millisecond
+			fakePolicyClient.GetPoliciesReturns(nil, errors.New("policy server unavailable"))
+			startAgent()
+
+			Expect(policyAgent.HealthzCheck(nil)).To(Succeed())
+			Eventually(func() error { return policyAgent.HealthzCheck(nil) }).Should(MatchError(ContainSubstring("exceeding threshold")))
+		})
+
+		It("stays live while single policies keep failing", func() {
+			config.SyncStaleThreshold = 100 * time.Millisecond
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					return errors.New("denied by admission webhook")
+				},
+			}).Build()
+			fakeReconciler = reconciler.New(fakeClient, &events.FakeRecorder{}, config, logger)
+			fakePolicyClient.GetSecurityGroupsForSpaceReturns([]policy.SecurityGroup{{
+				Guid:           "rejected",
+				Name:           "rejected",
+				RunningDefault: true,
+				Rules:          []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}},
+			}}, nil)
+			policyAgent = agent.New(fakeClient, fakeCacheSyncer, fakePolicyClient, fakeReconciler, config, logger)
+			startAgent()
+
+			Consistently(func() error { return policyAgent.HealthzCheck(nil) }, "300ms").Should(Succeed())
+			Expect(policyAgent.ReadyzCheck(nil)).To(MatchError(ContainSubstring("first successful sync")))
+		})
+	})
 })
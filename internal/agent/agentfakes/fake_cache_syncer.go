@@ -0,0 +1,110 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package agentfakes
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/agent"
+)
+
+type FakeCacheSyncer struct {
+	WaitForCacheSyncStub        func(context.Context) bool
+	waitForCacheSyncMutex       sync.RWMutex
+	waitForCacheSyncArgsForCall []struct {
+		arg1 context.Context
+	}
+	waitForCacheSyncReturns struct {
+		result1 bool
+	}
+	waitForCacheSyncReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSync(arg1 context.Context) bool {
+	fake.waitForCacheSyncMutex.Lock()
+	ret, specificReturn := fake.waitForCacheSyncReturnsOnCall[len(fake.waitForCacheSyncArgsForCall)]
+	fake.waitForCacheSyncArgsForCall = append(fake.waitForCacheSyncArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	stub := fake.WaitForCacheSyncStub
+	fakeReturns := fake.waitForCacheSyncReturns
+	fake.recordInvocation("WaitForCacheSync", []interface{}{arg1})
+	fake.waitForCacheSyncMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSyncCallCount() int {
+	fake.waitForCacheSyncMutex.RLock()
+	defer fake.waitForCacheSyncMutex.RUnlock()
+	return len(fake.waitForCacheSyncArgsForCall)
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSyncCalls(stub func(context.Context) bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = stub
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSyncArgsForCall(i int) context.Context {
+	fake.waitForCacheSyncMutex.RLock()
+	defer fake.waitForCacheSyncMutex.RUnlock()
+	argsForCall := fake.waitForCacheSyncArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSyncReturns(result1 bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = nil
+	fake.waitForCacheSyncReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeCacheSyncer) WaitForCacheSyncReturnsOnCall(i int, result1 bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = nil
+	if fake.waitForCacheSyncReturnsOnCall == nil {
+		fake.waitForCacheSyncReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.waitForCacheSyncReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeCacheSyncer) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCacheSyncer) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ agent.CacheSyncer = new(FakeCacheSyncer)
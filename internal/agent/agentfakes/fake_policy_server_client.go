@@ -3,6 +3,7 @@ package agentfakes
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/agent"
 
@@ -22,6 +23,18 @@ type FakePolicyServerClient struct {
 		result1 []*policy_client.Policy
 		result2 error
 	}
+	GetPoliciesLastUpdatedStub        func() (int, error)
+	getPoliciesLastUpdatedMutex       sync.RWMutex
+	getPoliciesLastUpdatedArgsForCall []struct {
+	}
+	getPoliciesLastUpdatedReturns struct {
+		result1 int
+		result2 error
+	}
+	getPoliciesLastUpdatedReturnsOnCall map[int]struct {
+		result1 int
+		result2 error
+	}
 	GetSecurityGroupsForSpaceStub        func(...string) ([]policy_client.SecurityGroup, error)
 	getSecurityGroupsForSpaceMutex       sync.RWMutex
 	getSecurityGroupsForSpaceArgsForCall []struct {
@@ -35,6 +48,18 @@ type FakePolicyServerClient struct {
 		result1 []policy_client.SecurityGroup
 		result2 error
 	}
+	GetSecurityGroupsLastUpdatedTimestampStub        func() (time.Time, error)
+	getSecurityGroupsLastUpdatedTimestampMutex       sync.RWMutex
+	getSecurityGroupsLastUpdatedTimestampArgsForCall []struct {
+	}
+	getSecurityGroupsLastUpdatedTimestampReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	getSecurityGroupsLastUpdatedTimestampReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -95,6 +120,62 @@ func (fake *FakePolicyServerClient) GetPoliciesReturnsOnCall(i int, result1 []*p
 	}{result1, result2}
 }
 
+func (fake *FakePolicyServerClient) GetPoliciesLastUpdated() (int, error) {
+	fake.getPoliciesLastUpdatedMutex.Lock()
+	ret, specificReturn := fake.getPoliciesLastUpdatedReturnsOnCall[len(fake.getPoliciesLastUpdatedArgsForCall)]
+	fake.getPoliciesLastUpdatedArgsForCall = append(fake.getPoliciesLastUpdatedArgsForCall, struct {
+	}{})
+	stub := fake.GetPoliciesLastUpdatedStub
+	fakeReturns := fake.getPoliciesLastUpdatedReturns
+	fake.recordInvocation("GetPoliciesLastUpdated", []interface{}{})
+	fake.getPoliciesLastUpdatedMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePolicyServerClient) GetPoliciesLastUpdatedCallCount() int {
+	fake.getPoliciesLastUpdatedMutex.RLock()
+	defer fake.getPoliciesLastUpdatedMutex.RUnlock()
+	return len(fake.getPoliciesLastUpdatedArgsForCall)
+}
+
+func (fake *FakePolicyServerClient) GetPoliciesLastUpdatedCalls(stub func() (int, error)) {
+	fake.getPoliciesLastUpdatedMutex.Lock()
+	defer fake.getPoliciesLastUpdatedMutex.Unlock()
+	fake.GetPoliciesLastUpdatedStub = stub
+}
+
+func (fake *FakePolicyServerClient) GetPoliciesLastUpdatedReturns(result1 int, result2 error) {
+	fake.getPoliciesLastUpdatedMutex.Lock()
+	defer fake.getPoliciesLastUpdatedMutex.Unlock()
+	fake.GetPoliciesLastUpdatedStub = nil
+	fake.getPoliciesLastUpdatedReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePolicyServerClient) GetPoliciesLastUpdatedReturnsOnCall(i int, result1 int, result2 error) {
+	fake.getPoliciesLastUpdatedMutex.Lock()
+	defer fake.getPoliciesLastUpdatedMutex.Unlock()
+	fake.GetPoliciesLastUpdatedStub = nil
+	if fake.getPoliciesLastUpdatedReturnsOnCall == nil {
+		fake.getPoliciesLastUpdatedReturnsOnCall = make(map[int]struct {
+			result1 int
+			result2 error
+		})
+	}
+	fake.getPoliciesLastUpdatedReturnsOnCall[i] = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakePolicyServerClient) GetSecurityGroupsForSpace(arg1 ...string) ([]policy_client.SecurityGroup, error) {
 	fake.getSecurityGroupsForSpaceMutex.Lock()
 	ret, specificReturn := fake.getSecurityGroupsForSpaceReturnsOnCall[len(fake.getSecurityGroupsForSpaceArgsForCall)]
@@ -159,6 +240,62 @@ func (fake *FakePolicyServerClient) GetSecurityGroupsForSpaceReturnsOnCall(i int
 	}{result1, result2}
 }
 
+func (fake *FakePolicyServerClient) GetSecurityGroupsLastUpdatedTimestamp() (time.Time, error) {
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.Lock()
+	ret, specificReturn := fake.getSecurityGroupsLastUpdatedTimestampReturnsOnCall[len(fake.getSecurityGroupsLastUpdatedTimestampArgsForCall)]
+	fake.getSecurityGroupsLastUpdatedTimestampArgsForCall = append(fake.getSecurityGroupsLastUpdatedTimestampArgsForCall, struct {
+	}{})
+	stub := fake.GetSecurityGroupsLastUpdatedTimestampStub
+	fakeReturns := fake.getSecurityGroupsLastUpdatedTimestampReturns
+	fake.recordInvocation("GetSecurityGroupsLastUpdatedTimestamp", []interface{}{})
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakePolicyServerClient) GetSecurityGroupsLastUpdatedTimestampCallCount() int {
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.RLock()
+	defer fake.getSecurityGroupsLastUpdatedTimestampMutex.RUnlock()
+	return len(fake.getSecurityGroupsLastUpdatedTimestampArgsForCall)
+}
+
+func (fake *FakePolicyServerClient) GetSecurityGroupsLastUpdatedTimestampCalls(stub func() (time.Time, error)) {
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.Lock()
+	defer fake.getSecurityGroupsLastUpdatedTimestampMutex.Unlock()
+	fake.GetSecurityGroupsLastUpdatedTimestampStub = stub
+}
+
+func (fake *FakePolicyServerClient) GetSecurityGroupsLastUpdatedTimestampReturns(result1 time.Time, result2 error) {
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.Lock()
+	defer fake.getSecurityGroupsLastUpdatedTimestampMutex.Unlock()
+	fake.GetSecurityGroupsLastUpdatedTimestampStub = nil
+	fake.getSecurityGroupsLastUpdatedTimestampReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakePolicyServerClient) GetSecurityGroupsLastUpdatedTimestampReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.getSecurityGroupsLastUpdatedTimestampMutex.Lock()
+	defer fake.getSecurityGroupsLastUpdatedTimestampMutex.Unlock()
+	fake.GetSecurityGroupsLastUpdatedTimestampStub = nil
+	if fake.getSecurityGroupsLastUpdatedTimestampReturnsOnCall == nil {
+		fake.getSecurityGroupsLastUpdatedTimestampReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.getSecurityGroupsLastUpdatedTimestampReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakePolicyServerClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
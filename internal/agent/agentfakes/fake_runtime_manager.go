@@ -7,7 +7,10 @@ import (
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/agent"
 
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/events"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
@@ -23,6 +26,52 @@ type FakeRuntimeManager struct {
 	addReturnsOnCall map[int]struct {
 		result1 error
 	}
+	AddHealthzCheckStub        func(string, healthz.Checker) error
+	addHealthzCheckMutex       sync.RWMutex
+	addHealthzCheckArgsForCall []struct {
+		arg1 string
+		arg2 healthz.Checker
+	}
+	addHealthzCheckReturns struct {
+		result1 error
+	}
+	addHealthzCheckReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AddPodEventHandlerStub        func(cache.ResourceEventHandler) error
+	addPodEventHandlerMutex       sync.RWMutex
+	addPodEventHandlerArgsForCall []struct {
+		arg1 cache.ResourceEventHandler
+	}
+	addPodEventHandlerReturns struct {
+		result1 error
+	}
+	addPodEventHandlerReturnsOnCall map[int]struct {
+		result1 error
+	}
+	AddReadyzCheckStub        func(string, healthz.Checker) error
+	addReadyzCheckMutex       sync.RWMutex
+	addReadyzCheckArgsForCall []struct {
+		arg1 string
+		arg2 healthz.Checker
+	}
+	addReadyzCheckReturns struct {
+		result1 error
+	}
+	addReadyzCheckReturnsOnCall map[int]struct {
+		result1 error
+	}
+	EventRecorderStub        func(string) events.EventRecorder
+	eventRecorderMutex       sync.RWMutex
+	eventRecorderArgsForCall []struct {
+		arg1 string
+	}
+	eventRecorderReturns struct {
+		result1 events.EventRecorder
+	}
+	eventRecorderReturnsOnCall map[int]struct {
+		result1 events.EventRecorder
+	}
 	KubernetesClientStub        func() client.Client
 	kubernetesClientMutex       sync.RWMutex
 	kubernetesClientArgsForCall []struct {
@@ -44,6 +93,17 @@ type FakeRuntimeManager struct {
 	startReturnsOnCall map[int]struct {
 		result1 error
 	}
+	WaitForCacheSyncStub        func(context.Context) bool
+	waitForCacheSyncMutex       sync.RWMutex
+	waitForCacheSyncArgsForCall []struct {
+		arg1 context.Context
+	}
+	waitForCacheSyncReturns struct {
+		result1 bool
+	}
+	waitForCacheSyncReturnsOnCall map[int]struct {
+		result1 bool
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -109,6 +169,252 @@ func (fake *FakeRuntimeManager) AddReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRuntimeManager) AddHealthzCheck(arg1 string, arg2 healthz.Checker) error {
+	fake.addHealthzCheckMutex.Lock()
+	ret, specificReturn := fake.addHealthzCheckReturnsOnCall[len(fake.addHealthzCheckArgsForCall)]
+	fake.addHealthzCheckArgsForCall = append(fake.addHealthzCheckArgsForCall, struct {
+		arg1 string
+		arg2 healthz.Checker
+	}{arg1, arg2})
+	stub := fake.AddHealthzCheckStub
+	fakeReturns := fake.addHealthzCheckReturns
+	fake.recordInvocation("AddHealthzCheck", []interface{}{arg1, arg2})
+	fake.addHealthzCheckMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRuntimeManager) AddHealthzCheckCallCount() int {
+	fake.addHealthzCheckMutex.RLock()
+	defer fake.addHealthzCheckMutex.RUnlock()
+	return len(fake.addHealthzCheckArgsForCall)
+}
+
+func (fake *FakeRuntimeManager) AddHealthzCheckCalls(stub func(string, healthz.Checker) error) {
+	fake.addHealthzCheckMutex.Lock()
+	defer fake.addHealthzCheckMutex.Unlock()
+	fake.AddHealthzCheckStub = stub
+}
+
+func (fake *FakeRuntimeManager) AddHealthzCheckArgsForCall(i int) (string, healthz.Checker) {
+	fake.addHealthzCheckMutex.RLock()
+	defer fake.addHealthzCheckMutex.RUnlock()
+	argsForCall := fake.addHealthzCheckArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRuntimeManager) AddHealthzCheckReturns(result1 error) {
+	fake.addHealthzCheckMutex.Lock()
+	defer fake.addHealthzCheckMutex.Unlock()
+	fake.AddHealthzCheckStub = nil
+	fake.addHealthzCheckReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) AddHealthzCheckReturnsOnCall(i int, result1 error) {
+	fake.addHealthzCheckMutex.Lock()
+	defer fake.addHealthzCheckMutex.Unlock()
+	fake.AddHealthzCheckStub = nil
+	if fake.addHealthzCheckReturnsOnCall == nil {
+		fake.addHealthzCheckReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addHealthzCheckReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandler(arg1 cache.ResourceEventHandler) error {
+	fake.addPodEventHandlerMutex.Lock()
+	ret, specificReturn := fake.addPodEventHandlerReturnsOnCall[len(fake.addPodEventHandlerArgsForCall)]
+	fake.addPodEventHandlerArgsForCall = append(fake.addPodEventHandlerArgsForCall, struct {
+		arg1 cache.ResourceEventHandler
+	}{arg1})
+	stub := fake.AddPodEventHandlerStub
+	fakeReturns := fake.addPodEventHandlerReturns
+	fake.recordInvocation("AddPodEventHandler", []interface{}{arg1})
+	fake.addPodEventHandlerMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandlerCallCount() int {
+	fake.addPodEventHandlerMutex.RLock()
+	defer fake.addPodEventHandlerMutex.RUnlock()
+	return len(fake.addPodEventHandlerArgsForCall)
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandlerCalls(stub func(cache.ResourceEventHandler) error) {
+	fake.addPodEventHandlerMutex.Lock()
+	defer fake.addPodEventHandlerMutex.Unlock()
+	fake.AddPodEventHandlerStub = stub
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandlerArgsForCall(i int) cache.ResourceEventHandler {
+	fake.addPodEventHandlerMutex.RLock()
+	defer fake.addPodEventHandlerMutex.RUnlock()
+	argsForCall := fake.addPodEventHandlerArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandlerReturns(result1 error) {
+	fake.addPodEventHandlerMutex.Lock()
+	defer fake.addPodEventHandlerMutex.Unlock()
+	fake.AddPodEventHandlerStub = nil
+	fake.addPodEventHandlerReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) AddPodEventHandlerReturnsOnCall(i int, result1 error) {
+	fake.addPodEventHandlerMutex.Lock()
+	defer fake.addPodEventHandlerMutex.Unlock()
+	fake.AddPodEventHandlerStub = nil
+	if fake.addPodEventHandlerReturnsOnCall == nil {
+		fake.addPodEventHandlerReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addPodEventHandlerReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheck(arg1 string, arg2 healthz.Checker) error {
+	fake.addReadyzCheckMutex.Lock()
+	ret, specificReturn := fake.addReadyzCheckReturnsOnCall[len(fake.addReadyzCheckArgsForCall)]
+	fake.addReadyzCheckArgsForCall = append(fake.addReadyzCheckArgsForCall, struct {
+		arg1 string
+		arg2 healthz.Checker
+	}{arg1, arg2})
+	stub := fake.AddReadyzCheckStub
+	fakeReturns := fake.addReadyzCheckReturns
+	fake.recordInvocation("AddReadyzCheck", []interface{}{arg1, arg2})
+	fake.addReadyzCheckMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheckCallCount() int {
+	fake.addReadyzCheckMutex.RLock()
+	defer fake.addReadyzCheckMutex.RUnlock()
+	return len(fake.addReadyzCheckArgsForCall)
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheckCalls(stub func(string, healthz.Checker) error) {
+	fake.addReadyzCheckMutex.Lock()
+	defer fake.addReadyzCheckMutex.Unlock()
+	fake.AddReadyzCheckStub = stub
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheckArgsForCall(i int) (string, healthz.Checker) {
+	fake.addReadyzCheckMutex.RLock()
+	defer fake.addReadyzCheckMutex.RUnlock()
+	argsForCall := fake.addReadyzCheckArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheckReturns(result1 error) {
+	fake.addReadyzCheckMutex.Lock()
+	defer fake.addReadyzCheckMutex.Unlock()
+	fake.AddReadyzCheckStub = nil
+	fake.addReadyzCheckReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) AddReadyzCheckReturnsOnCall(i int, result1 error) {
+	fake.addReadyzCheckMutex.Lock()
+	defer fake.addReadyzCheckMutex.Unlock()
+	fake.AddReadyzCheckStub = nil
+	if fake.addReadyzCheckReturnsOnCall == nil {
+		fake.addReadyzCheckReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addReadyzCheckReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) EventRecorder(arg1 string) events.EventRecorder {
+	fake.eventRecorderMutex.Lock()
+	ret, specificReturn := fake.eventRecorderReturnsOnCall[len(fake.eventRecorderArgsForCall)]
+	fake.eventRecorderArgsForCall = append(fake.eventRecorderArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.EventRecorderStub
+	fakeReturns := fake.eventRecorderReturns
+	fake.recordInvocation("EventRecorder", []interface{}{arg1})
+	fake.eventRecorderMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRuntimeManager) EventRecorderCallCount() int {
+	fake.eventRecorderMutex.RLock()
+	defer fake.eventRecorderMutex.RUnlock()
+	return len(fake.eventRecorderArgsForCall)
+}
+
+func (fake *FakeRuntimeManager) EventRecorderCalls(stub func(string) events.EventRecorder) {
+	fake.eventRecorderMutex.Lock()
+	defer fake.eventRecorderMutex.Unlock()
+	fake.EventRecorderStub = stub
+}
+
+func (fake *FakeRuntimeManager) EventRecorderArgsForCall(i int) string {
+	fake.eventRecorderMutex.RLock()
+	defer fake.eventRecorderMutex.RUnlock()
+	argsForCall := fake.eventRecorderArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRuntimeManager) EventRecorderReturns(result1 events.EventRecorder) {
+	fake.eventRecorderMutex.Lock()
+	defer fake.eventRecorderMutex.Unlock()
+	fake.EventRecorderStub = nil
+	fake.eventRecorderReturns = struct {
+		result1 events.EventRecorder
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) EventRecorderReturnsOnCall(i int, result1 events.EventRecorder) {
+	fake.eventRecorderMutex.Lock()
+	defer fake.eventRecorderMutex.Unlock()
+	fake.EventRecorderStub = nil
+	if fake.eventRecorderReturnsOnCall == nil {
+		fake.eventRecorderReturnsOnCall = make(map[int]struct {
+			result1 events.EventRecorder
+		})
+	}
+	fake.eventRecorderReturnsOnCall[i] = struct {
+		result1 events.EventRecorder
+	}{result1}
+}
+
 func (fake *FakeRuntimeManager) KubernetesClient() client.Client {
 	fake.kubernetesClientMutex.Lock()
 	ret, specificReturn := fake.kubernetesClientReturnsOnCall[len(fake.kubernetesClientArgsForCall)]
@@ -223,6 +529,67 @@ func (fake *FakeRuntimeManager) StartReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRuntimeManager) WaitForCacheSync(arg1 context.Context) bool {
+	fake.waitForCacheSyncMutex.Lock()
+	ret, specificReturn := fake.waitForCacheSyncReturnsOnCall[len(fake.waitForCacheSyncArgsForCall)]
+	fake.waitForCacheSyncArgsForCall = append(fake.waitForCacheSyncArgsForCall, struct {
+		arg1 context.Context
+	}{arg1})
+	stub := fake.WaitForCacheSyncStub
+	fakeReturns := fake.waitForCacheSyncReturns
+	fake.recordInvocation("WaitForCacheSync", []interface{}{arg1})
+	fake.waitForCacheSyncMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeRuntimeManager) WaitForCacheSyncCallCount() int {
+	fake.waitForCacheSyncMutex.RLock()
+	defer fake.waitForCacheSyncMutex.RUnlock()
+	return len(fake.waitForCacheSyncArgsForCall)
+}
+
+func (fake *FakeRuntimeManager) WaitForCacheSyncCalls(stub func(context.Context) bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = stub
+}
+
+func (fake *FakeRuntimeManager) WaitForCacheSyncArgsForCall(i int) context.Context {
+	fake.waitForCacheSyncMutex.RLock()
+	defer fake.waitForCacheSyncMutex.RUnlock()
+	argsForCall := fake.waitForCacheSyncArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRuntimeManager) WaitForCacheSyncReturns(result1 bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = nil
+	fake.waitForCacheSyncReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeRuntimeManager) WaitForCacheSyncReturnsOnCall(i int, result1 bool) {
+	fake.waitForCacheSyncMutex.Lock()
+	defer fake.waitForCacheSyncMutex.Unlock()
+	fake.WaitForCacheSyncStub = nil
+	if fake.waitForCacheSyncReturnsOnCall == nil {
+		fake.waitForCacheSyncReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.waitForCacheSyncReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
 func (fake *FakeRuntimeManager) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/config"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type permission struct {
+	group     string
+	resource  string
+	namespace string
+	verbs     []string
+}
+
+// requiredPermissions lists the RBAC permissions the agent needs, which are
+// granted by the roles of the Helm chart.
+func requiredPermissions(config *config.Config) []permission {
+	permissions := []permission{
+		{resource: "configmaps", namespace: config.Namespace, verbs: []string{"create", "update"}},
+		{group: "events.k8s.io", resource: "events", namespace: config.Namespace, verbs: []string{"create", "patch"}},
+	}
+
+	for _, namespace := range config.WorkloadNamespaces {
+		permissions = append(permissions,
+			permission{resource: "pods", namespace: namespace, verbs: []string{"get", "list", "watch"}},
+			permission{group: "cilium.io", resource: "ciliumnetworkpolicies", namespace: namespace, verbs: []string{"get", "list", "watch", "patch", "delete"}},
+		)
+		if namespace != config.Namespace {
+			permissions = append(permissions,
+				permission{group: "events.k8s.io", resource: "events", namespace: namespace, verbs: []string{"create", "patch"}},
+			)
+		}
+	}
+
+	// managed CiliumClusterwideNetworkPolicies are deleted even once global
+	// ASGs are no longer rendered clusterwide, but only written while they
+	// are. Events about cluster-scoped objects are recorded in the default
+	// namespace.
+	clusterwideVerbs := []string{"get", "list", "watch", "delete"}
+	if config.ClusterwideGlobalASGs {
+		clusterwideVerbs = append(clusterwideVerbs, "patch")
+	}
+	permissions = append(permissions,
+		permission{group: "cilium.io", resource: "ciliumclusterwidenetworkpolicies", verbs: clusterwideVerbs},
+		permission{group: "events.k8s.io", resource: "events", namespace: metav1.NamespaceDefault, verbs: []string{"create", "patch"}},
+	)
+
+	if config.LeaderElection && config.LeaderElectionNamespace != "" {
+		permissions = append(permissions,
+			permission{group: "coordination.k8s.io", resource: "leases", namespace: config.LeaderElectionNamespace, verbs: []string{"get", "create", "update"}},
+		)
+	}
+
+	return permissions
+}
+
+// VerifyPermissions checks with SelfSubjectAccessReviews that the agent is
+// allowed to perform every verb it needs and returns an error listing all
+// missing permissions.
+func VerifyPermissions(ctx context.Context, k8sclient client.Client, config *config.Config) error {
+	var missing []string
+	for _, p := range requiredPermissions(config) {
+		for _, verb := range p.verbs {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: p.namespace,
+						Verb:      verb,
+						Group:     p.group,
+						Resource:  p.resource,
+					},
+				},
+			}
+			if err := k8sclient.Create(ctx, review); err != nil {
+				return fmt.Errorf("failed to review access to %s: %w", p.resource, err)
+			}
+
+			if !review.Status.Allowed {
+				resource := p.resource
+				if p.group != "" {
+					resource += "." + p.group
+				}
+				if p.namespace == "" {
+					missing = append(missing, fmt.Sprintf("%s %s cluster-wide", verb, resource))
+				} else {
+					missing = append(missing, fmt.Sprintf("%s %s in namespace %q", verb, resource, p.namespace))
+				}
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing RBAC permissions, check the roles bound to the policy-agent service account: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/agent"
+	agentconfig "code.cloudfoundry.org/k8s-policy-agent/internal/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("VerifyPermissions", func() {
+	var (
+		config  *agentconfig.Config
+		reviews []authorizationv1.ResourceAttributes
+		denied  map[string]bool
+	)
+
+	newClient := func() ctrlclient.Client {
+		return fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.CreateOption) error {
+				review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+				if !ok {
+					return c.Create(ctx, obj, opts...)
+				}
+
+				attributes := *review.Spec.ResourceAttributes
+				reviews = append(reviews, attributes)
+				review.Status.Allowed = !denied[attributes.Verb+" "+attributes.Resource]
+				return nil
+			},
+		}).Build()
+	}
+
+	BeforeEach(func() {
+		config = &agentconfig.Config{Namespace: "cf-workloads", WorkloadNamespaces: []string{"cf-workloads"}}
+		reviews = nil
+		denied = map[string]bool{}
+	})
+
+	It("succeeds when every required verb is allowed", func() {
+		Expect(agent.VerifyPermissions(context.Background(), newClient(), config)).To(Succeed())
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "cf-workloads",
+			Verb:      "delete",
+			Group:     "cilium.io",
+			Resource:  "ciliumnetworkpolicies",
+		}))
+		Expect(reviews).NotTo(ContainElement(HaveField("Resource", "leases")))
+	})
+
+	It("reviews deleting CiliumClusterwideNetworkPolicies even when global ASGs are rendered namespaced", func() {
+		Expect(agent.VerifyPermissions(context.Background(), newClient(), config)).To(Succeed())
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Verb:     "delete",
+			Group:    "cilium.io",
+			Resource: "ciliumclusterwidenetworkpolicies",
+		}))
+		Expect(reviews).NotTo(ContainElement(authorizationv1.ResourceAttributes{
+			Verb:     "patch",
+			Group:    "cilium.io",
+			Resource: "ciliumclusterwidenetworkpolicies",
+		}))
+	})
+
+	It("reviews leases in the leader election namespace", func() {
+		config.LeaderElection = true
+		config.LeaderElectionNamespace = "policy-agent-system"
+
+		Expect(agent.VerifyPermissions(context.Background(), newClient(), config)).To(Succeed())
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "policy-agent-system",
+			Verb:      "update",
+			Group:     "coordination.k8s.io",
+			Resource:  "leases",
+		}))
+	})
+
+	It("reviews pods and policies in every workload namespace", func() {
+		config.WorkloadNamespaces = []string{"cf-workloads", "cf-workloads-b"}
+
+		Expect(agent.VerifyPermissions(context.Background(), newClient(), config)).To(Succeed())
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "cf-workloads-b",
+			Verb:      "watch",
+			Resource:  "pods",
+		}))
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "cf-workloads-b",
+			Verb:      "patch",
+			Group:     "cilium.io",
+			Resource:  "ciliumnetworkpolicies",
+		}))
+		Expect(reviews).NotTo(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "cf-workloads-b",
+			Verb:      "update",
+			Resource:  "configmaps",
+		}))
+	})
+
+	It("reviews CiliumClusterwideNetworkPolicies cluster-wide when global ASGs are rendered clusterwide", func() {
+		config.ClusterwideGlobalASGs = true
+		denied["patch ciliumclusterwidenetworkpolicies"] = true
+
+		err := agent.VerifyPermissions(context.Background(), newClient(), config)
+		Expect(err).To(MatchError(ContainSubstring("patch ciliumclusterwidenetworkpolicies.cilium.io cluster-wide")))
+		Expect(reviews).To(ContainElement(authorizationv1.ResourceAttributes{
+			Namespace: "default",
+			Verb:      "create",
+			Group:     "events.k8s.io",
+			Resource:  "events",
+		}))
+	})
+
+	It("lists every missing permission", func() {
+		denied["watch pods"] = true
+		denied["delete ciliumnetworkpolicies"] = true
+
+		err := agent.VerifyPermissions(context.Background(), newClient(), config)
+		Expect(err).To(MatchError(ContainSubstring(`watch pods in namespace "cf-workloads"`)))
+		Expect(err).To(MatchError(ContainSubstring(`delete ciliumnetworkpolicies.cilium.io in namespace "cf-workloads"`)))
+	})
+
+	It("fails when the access review cannot be created", func() {
+		client := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.CreateOption) error {
+				return errors.New("connection refused")
+			},
+		}).Build()
+
+		Expect(agent.VerifyPermissions(context.Background(), client, config)).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
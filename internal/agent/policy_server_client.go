@@ -2,8 +2,10 @@ package agent
 
 import (
 	"net/http"
+	"time"
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
 
 	"code.cloudfoundry.org/lager/v3"
 	policy "code.cloudfoundry.org/policy_client"
@@ -13,7 +15,9 @@ import (
 //counterfeiter:generate . PolicyServerClient
 type PolicyServerClient interface {
 	GetSecurityGroupsForSpace(spaceGuids ...string) ([]policy.SecurityGroup, error)
+	GetSecurityGroupsLastUpdatedTimestamp() (time.Time, error)
 	GetPolicies() ([]*policy.Policy, error)
+	GetPoliciesLastUpdated() (int, error)
 }
 
 type policyServerClient struct {
@@ -36,11 +40,41 @@ func NewPolicyServerClient(logger lager.Logger, config *config.Config) (PolicySe
 }
 
 func (p *policyServerClient) GetSecurityGroupsForSpace(spaceGuids ...string) ([]policy.SecurityGroup, error) {
-	return p.internalClient.GetSecurityGroupsForSpace(spaceGuids...)
+	defer observeRequest("get_security_groups_for_space", time.Now())
+	securityGroups, err := p.internalClient.GetSecurityGroupsForSpace(spaceGuids...)
+	countRequestError("get_security_groups_for_space", err)
+	return securityGroups, err
+}
+
+func (p *policyServerClient) GetSecurityGroupsLastUpdatedTimestamp() (time.Time, error) {
+	defer observeRequest("get_security_groups_last_updated", time.Now())
+	lastUpdated, err := p.internalClient.GetSecurityGroupsLastUpdatedTimestamp()
+	countRequestError("get_security_groups_last_updated", err)
+	return lastUpdated, err
 }
 
 func (p *policyServerClient) GetPolicies() ([]*policy.Policy, error) {
-	return p.internalClient.GetPolicies()
+	defer observeRequest("get_policies", time.Now())
+	policies, err := p.internalClient.GetPolicies()
+	countRequestError("get_policies", err)
+	return policies, err
+}
+
+func (p *policyServerClient) GetPoliciesLastUpdated() (int, error) {
+	defer observeRequest("get_policies_last_updated", time.Now())
+	lastUpdated, err := p.internalClient.GetPoliciesLastUpdated()
+	countRequestError("get_policies_last_updated", err)
+	return lastUpdated, err
+}
+
+func observeRequest(call string, start time.Time) {
+	metrics.PolicyServerRequestDuration.WithLabelValues(call).Observe(time.Since(start).Seconds())
+}
+
+func countRequestError(call string, err error) {
+	if err != nil {
+		metrics.PolicyServerRequestErrors.WithLabelValues(call).Inc()
+	}
 }
 
 func newMTLSClient(config *config.Config) (*http.Client, error) {
@@ -14,11 +14,15 @@ import (
 	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	ctrlmanager "sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 var (
@@ -32,12 +36,27 @@ func init() {
 
 type runtimeManager struct {
 	runtimeManager ctrlmanager.Manager
+	podInformer    cache.Informer
+}
+
+// CacheSyncer waits until the informer caches backing the Kubernetes client
+// are synced or the context is done.
+//
+//counterfeiter:generate . CacheSyncer
+type CacheSyncer interface {
+	WaitForCacheSync(ctx context.Context) bool
 }
 
 //counterfeiter:generate . RuntimeManager
 type RuntimeManager interface {
+	CacheSyncer
+
 	KubernetesClient() client.Client
 	Add(r ctrlmanager.Runnable) error
+	AddPodEventHandler(handler toolscache.ResourceEventHandler) error
+	EventRecorder(name string) events.EventRecorder
+	AddHealthzCheck(name string, check healthz.Checker) error
+	AddReadyzCheck(name string, check healthz.Checker) error
 	Start(ctx context.Context) error
 }
 
@@ -52,25 +71,62 @@ func NewRuntimeManager(ctx context.Context, logger lager.Logger, config *config.
 		return nil, err
 	}
 
-	mgr, err := ctrlmanager.New(ctrl.GetConfigOrDie(), ctrlmanager.Options{
+	// pods and policies are only cached in the workload namespaces
+	workloadNamespaces := map[string]cache.Config{}
+	for _, namespace := range config.WorkloadNamespaces {
+		workloadNamespaces[namespace] = cache.Config{}
+	}
+
+	cacheByObject := map[client.Object]cache.ByObject{
+		&corev1.Pod{}: {
+			Label:      labels.NewSelector().Add(*podSelector),
+			Namespaces: workloadNamespaces,
+		},
+		&ciliumv2.CiliumNetworkPolicy{}: {
+			Label:      labels.NewSelector().Add(*networkPolicySelector),
+			Namespaces: workloadNamespaces,
+		},
+		// managed clusterwide policies are cached even if global ASGs are
+		// rendered namespaced, so that they are cleaned up
+		&ciliumv2.CiliumClusterwideNetworkPolicy{}: {
+			Label: labels.NewSelector().Add(*networkPolicySelector),
+		},
+	}
+
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS = float32(config.KubeAPIQPS)
+	restConfig.Burst = config.KubeAPIBurst
+
+	mgr, err := ctrlmanager.New(restConfig, ctrlmanager.Options{
 		Logger: klog.NewKlogr().V(3),
 		Scheme: scheme,
+		Metrics: metricsserver.Options{
+			BindAddress: config.MetricsBindAddress,
+		},
+		HealthProbeBindAddress: config.HealthProbeAddress,
+
+		LeaderElection:                config.LeaderElection,
+		LeaderElectionID:              config.LeaderElectionID,
+		LeaderElectionNamespace:       config.LeaderElectionNamespace,
+		LeaderElectionReleaseOnCancel: true,
+		LeaseDuration:                 &config.LeaseDuration,
+		RenewDeadline:                 &config.RenewDeadline,
+		RetryPeriod:                   &config.RetryPeriod,
+
 		Cache: cache.Options{
-			ByObject: map[client.Object]cache.ByObject{
-				&corev1.Pod{}: {
-					Label: labels.NewSelector().Add(*podSelector),
-				},
-				&ciliumv2.CiliumNetworkPolicy{}: {
-					Label: labels.NewSelector().Add(*networkPolicySelector),
-				},
-			},
+			ByObject: cacheByObject,
 		},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := mgr.GetCache().GetInformer(ctx, &corev1.Pod{}); err != nil {
+	if err := VerifyPermissions(ctx, mgr.GetClient(), config); err != nil {
+		return nil, err
+	}
+
+	podInformer, err := mgr.GetCache().GetInformer(ctx, &corev1.Pod{})
+	if err != nil {
 		return nil, err
 	}
 
@@ -78,8 +134,13 @@ func NewRuntimeManager(ctx context.Context, logger lager.Logger, config *config.
 		return nil, err
 	}
 
+	if _, err := mgr.GetCache().GetInformer(ctx, &ciliumv2.CiliumClusterwideNetworkPolicy{}); err != nil {
+		return nil, err
+	}
+
 	return &runtimeManager{
 		runtimeManager: mgr,
+		podInformer:    podInformer,
 	}, nil
 }
 
@@ -87,10 +148,31 @@ func (m *runtimeManager) KubernetesClient() client.Client {
 	return m.runtimeManager.GetClient()
 }
 
+func (m *runtimeManager) WaitForCacheSync(ctx context.Context) bool {
+	return m.runtimeManager.GetCache().WaitForCacheSync(ctx)
+}
+
 func (m *runtimeManager) Add(r ctrlmanager.Runnable) error {
 	return m.runtimeManager.Add(r)
 }
 
+func (m *runtimeManager) AddPodEventHandler(handler toolscache.ResourceEventHandler) error {
+	_, err := m.podInformer.AddEventHandler(handler)
+	return err
+}
+
+func (m *runtimeManager) EventRecorder(name string) events.EventRecorder {
+	return m.runtimeManager.GetEventRecorder(name)
+}
+
+func (m *runtimeManager) AddHealthzCheck(name string, check healthz.Checker) error {
+	return m.runtimeManager.AddHealthzCheck(name, check)
+}
+
+func (m *runtimeManager) AddReadyzCheck(name string, check healthz.Checker) error {
+	return m.runtimeManager.AddReadyzCheck(name, check)
+}
+
 func (m *runtimeManager) Start(ctx context.Context) error {
 	return m.runtimeManager.Start(ctx)
 }
@@ -4,37 +4,146 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	DefaultNamespace             = "cf-workloads"
 	DefaultPollInterval          = 5 * time.Second
+	DefaultReconcileDebounce     = 1 * time.Second
+	DefaultFullResyncInterval    = 5 * time.Minute
+	DefaultMetricsBindAddress    = ":8080"
+	DefaultHealthProbeAddress    = ":8081"
+	DefaultSyncStaleThreshold    = 10 * time.Minute
+	DefaultCacheSyncTimeout      = 2 * time.Minute
+	DefaultLeaderElectionID      = "policy-agent-leader"
+	DefaultLeaseDuration         = 15 * time.Second
+	DefaultRenewDeadline         = 10 * time.Second
+	DefaultRetryPeriod           = 2 * time.Second
+	DefaultDeletionGuardPercent  = 50
+	DefaultDeletionGuardPasses   = 3
 	DefaultPerPageSecurityGroups = 100
 	DefaultTLSCertPath           = "/etc/ssl/certs/policy-agent/tls.crt"
 	DefaultTLSKeyPath            = "/etc/ssl/certs/policy-agent/tls.key"
 	DefaultTLSCAPath             = "/etc/ssl/certs/policy-agent/ca.crt"
+	DefaultC2CEnforcement        = C2CEnforcementEgress
+	DefaultWriteConcurrency      = 8
+	DefaultKubeAPIQPS            = 20
+	DefaultKubeAPIBurst          = 30
+	DefaultDriftPolicy           = DriftPolicyRevert
+)
+
+// C2C enforcement modes select on which side C2C policies are enforced.
+const (
+	C2CEnforcementEgress  = "egress"
+	C2CEnforcementIngress = "ingress"
+	C2CEnforcementBoth    = "both"
+)
+
+// Drift policies select how manual edits of the specs of managed policies
+// are handled.
+const (
+	DriftPolicyRevert = "revert"
+	DriftPolicyReport = "report"
 )
 
 type Config struct {
 	PolicyServerURL       string
 	Namespace             string
 	PollInterval          time.Duration
+	ReconcileDebounce     time.Duration
+	FullResyncInterval    time.Duration
 	PerPageSecurityGroups int
 	TLSCertPath           string
 	TLSKeyPath            string
 	TLSCAPath             string
+	MetricsBindAddress    string
+	HealthProbeAddress    string
+	SyncStaleThreshold    time.Duration
+	CacheSyncTimeout      time.Duration
+
+	LeaderElection          bool
+	LeaderElectionID        string
+	LeaderElectionNamespace string
+	LeaseDuration           time.Duration
+	RenewDeadline           time.Duration
+	RetryPeriod             time.Duration
+
+	// DeletionGuardMaxCount and DeletionGuardMaxPercent withhold deletions of
+	// obsolete CiliumNetworkPolicies above the given absolute number or share
+	// of all managed policies, zero disables the respective threshold.
+	DeletionGuardMaxCount   int
+	DeletionGuardMaxPercent int
+	// DeletionGuardPasses is the number of consecutive reconciles with fresh
+	// policy server data a withheld deletion must persist before it is
+	// executed, which also takes at least DeletionGuardPasses poll intervals.
+	DeletionGuardPasses int
+
+	// WorkloadNamespaces are the namespaces of CF pods, every policy is
+	// rendered into the workload namespaces hosting pods it applies to. The
+	// status ConfigMap is kept in Namespace, which is the default.
+	WorkloadNamespaces []string
+	// ClusterwideGlobalASGs renders staging and running default ASGs as
+	// CiliumClusterwideNetworkPolicies selecting the workload namespaces
+	// instead of one CiliumNetworkPolicy per workload namespace.
+	ClusterwideGlobalASGs bool
+	// FQDNDestinations translates hostname destinations of ASG rules into
+	// ToFQDNs rules, which requires the Cilium DNS proxy.
+	FQDNDestinations bool
+	// StrictICMPCodes drops ICMP rules restricted to codes Cilium cannot
+	// express instead of allowing all codes of their type.
+	StrictICMPCodes bool
+	// C2CEnforcement renders C2C policies as egress rules of the source apps,
+	// ingress rules of the destination apps or both.
+	C2CEnforcement string
+	// WriteConcurrency limits the number of policies written in parallel.
+	WriteConcurrency int
+	// KubeAPIQPS and KubeAPIBurst limit the rate of requests to the
+	// Kubernetes API.
+	KubeAPIQPS   int
+	KubeAPIBurst int
+	// DriftPolicy either reverts manual edits of the specs of managed
+	// policies or only reports them.
+	DriftPolicy string
 }
 
 func Load() *Config {
 	return &Config{
 		PolicyServerURL:       getEnvOrDie("POLICY_SERVER_URL"),
 		Namespace:             getEnvOrDefault("NAMESPACE", DefaultNamespace),
-		PollInterval:          getPollIntervalOrDefault("POLL_INTERVAL", DefaultPollInterval),
+		PollInterval:          getDurationOrDefault("POLL_INTERVAL", DefaultPollInterval),
+		ReconcileDebounce:     getDurationOrDefault("RECONCILE_DEBOUNCE", DefaultReconcileDebounce),
+		FullResyncInterval:    getDurationOrDefault("FULL_RESYNC_INTERVAL", DefaultFullResyncInterval),
 		PerPageSecurityGroups: getPerPageSecurityGroups(),
 		TLSCertPath:           getEnvOrDefault("TLS_CERT_PATH", DefaultTLSCertPath),
 		TLSKeyPath:            getEnvOrDefault("TLS_KEY_PATH", DefaultTLSKeyPath),
 		TLSCAPath:             getEnvOrDefault("TLS_CA_PATH", DefaultTLSCAPath),
+		MetricsBindAddress:    getEnvOrDefault("METRICS_BIND_ADDRESS", DefaultMetricsBindAddress),
+		HealthProbeAddress:    getEnvOrDefault("HEALTH_PROBE_BIND_ADDRESS", DefaultHealthProbeAddress),
+		SyncStaleThreshold:    getDurationOrDefault("SYNC_STALE_THRESHOLD", DefaultSyncStaleThreshold),
+		CacheSyncTimeout:      getDurationOrDefault("CACHE_SYNC_TIMEOUT", DefaultCacheSyncTimeout),
+
+		LeaderElection:          getBoolOrDefault("LEADER_ELECTION", false),
+		LeaderElectionID:        getEnvOrDefault("LEADER_ELECTION_ID", DefaultLeaderElectionID),
+		LeaderElectionNamespace: os.Getenv("LEADER_ELECTION_NAMESPACE"),
+		LeaseDuration:           getDurationOrDefault("LEADER_ELECTION_LEASE_DURATION", DefaultLeaseDuration),
+		RenewDeadline:           getDurationOrDefault("LEADER_ELECTION_RENEW_DEADLINE", DefaultRenewDeadline),
+		RetryPeriod:             getDurationOrDefault("LEADER_ELECTION_RETRY_PERIOD", DefaultRetryPeriod),
+
+		DeletionGuardMaxCount:   getIntOrDefault("DELETION_GUARD_MAX_COUNT", 0),
+		DeletionGuardMaxPercent: getIntOrDefault("DELETION_GUARD_MAX_PERCENT", DefaultDeletionGuardPercent),
+		DeletionGuardPasses:     getIntOrDefault("DELETION_GUARD_PASSES", DefaultDeletionGuardPasses),
+
+		WorkloadNamespaces:    getListOrDefault("WORKLOAD_NAMESPACES", []string{getEnvOrDefault("NAMESPACE", DefaultNamespace)}),
+		ClusterwideGlobalASGs: getBoolOrDefault("CLUSTERWIDE_GLOBAL_ASGS", false),
+		FQDNDestinations:      getBoolOrDefault("FQDN_DESTINATIONS", false),
+		StrictICMPCodes:       getBoolOrDefault("STRICT_ICMP_CODES", false),
+		C2CEnforcement:        getC2CEnforcement(),
+		WriteConcurrency:      getIntOrDefault("WRITE_CONCURRENCY", DefaultWriteConcurrency),
+		KubeAPIQPS:            getIntOrDefault("KUBE_API_QPS", DefaultKubeAPIQPS),
+		KubeAPIBurst:          getIntOrDefault("KUBE_API_BURST", DefaultKubeAPIBurst),
+		DriftPolicy:           getDriftPolicy(),
 	}
 }
 
@@ -52,21 +161,81 @@ func getEnvOrDie(key string) string {
 	panic("'" + key + "' environment variable is required but not set")
 }
 
-func getPollIntervalOrDefault(key string, defaultValue time.Duration) time.Duration {
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
 	dur, err := time.ParseDuration(os.Getenv(key))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading poll interval from '%s': %v, falling back to %v\n", key, err, defaultValue)
+		fmt.Fprintf(os.Stderr, "error reading duration from '%s': %v, falling back to %v\n", key, err, defaultValue)
 		dur = defaultValue
 	}
 
 	if dur <= 0 {
-		fmt.Fprintf(os.Stderr, "poll interval must be positive, falling back to %v\n", defaultValue)
+		fmt.Fprintf(os.Stderr, "'%s' must be positive, falling back to %v\n", key, defaultValue)
 		dur = defaultValue
 	}
 
 	return dur
 }
 
+func getBoolOrDefault(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading boolean from '%s': %v, falling back to %v\n", key, err, defaultValue)
+		value = defaultValue
+	}
+
+	return value
+}
+
+// getListOrDefault splits a comma separated list, ignoring empty entries.
+func getListOrDefault(key string, defaultValue []string) []string {
+	var values []string
+	for value := range strings.SplitSeq(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+func getIntOrDefault(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading integer from '%s': %v, falling back to %d\n", key, err, defaultValue)
+		return defaultValue
+	}
+
+	if value < 0 {
+		fmt.Fprintf(os.Stderr, "'%s' must not be negative, falling back to %d\n", key, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
+func getC2CEnforcement() string {
+	switch mode := getEnvOrDefault("C2C_ENFORCEMENT", DefaultC2CEnforcement); mode {
+	case C2CEnforcementEgress, C2CEnforcementIngress, C2CEnforcementBoth:
+		return mode
+	default:
+		fmt.Fprintf(os.Stderr, "invalid C2C enforcement '%s', falling back to %s\n", mode, DefaultC2CEnforcement)
+		return DefaultC2CEnforcement
+	}
+}
+
+func getDriftPolicy() string {
+	switch policy := getEnvOrDefault("DRIFT_POLICY", DefaultDriftPolicy); policy {
+	case DriftPolicyRevert, DriftPolicyReport:
+		return policy
+	default:
+		fmt.Fprintf(os.Stderr, "invalid drift policy '%s', falling back to %s\n", policy, DefaultDriftPolicy)
+		return DefaultDriftPolicy
+	}
+}
+
 func getPerPageSecurityGroups() int {
 	perPageStr := os.Getenv("PER_PAGE_SECURITY_GROUPS")
 	perPage, err := strconv.Atoi(perPageStr)
@@ -36,18 +36,73 @@ var _ = Describe("Config", func() {
 				"POLICY_SERVER_URL":        "http://example.com",
 				"NAMESPACE":                "custom-ns",
 				"POLL_INTERVAL":            "42s",
+				"RECONCILE_DEBOUNCE":       "3s",
+				"FULL_RESYNC_INTERVAL":     "10m",
 				"PER_PAGE_SECURITY_GROUPS": "77",
 				"TLS_CERT_PATH":            "/custom/cert",
 				"TLS_KEY_PATH":             "/custom/key",
 				"TLS_CA_PATH":              "/custom/ca",
+				"METRICS_BIND_ADDRESS":     ":9090",
+
+				"HEALTH_PROBE_BIND_ADDRESS": ":9091",
+				"SYNC_STALE_THRESHOLD":      "1h",
+				"CACHE_SYNC_TIMEOUT":        "30s",
+
+				"LEADER_ELECTION":                "true",
+				"LEADER_ELECTION_ID":             "custom-leader",
+				"LEADER_ELECTION_NAMESPACE":      "custom-lease-ns",
+				"LEADER_ELECTION_LEASE_DURATION": "30s",
+				"LEADER_ELECTION_RENEW_DEADLINE": "20s",
+				"LEADER_ELECTION_RETRY_PERIOD":   "5s",
+
+				"DELETION_GUARD_MAX_COUNT":   "10",
+				"DELETION_GUARD_MAX_PERCENT": "25",
+				"DELETION_GUARD_PASSES":      "5",
+
+				"WORKLOAD_NAMESPACES":     "cf-workloads-a, cf-workloads-b,",
+				"CLUSTERWIDE_GLOBAL_ASGS": "true",
+				"FQDN_DESTINATIONS":       "true",
+				"STRICT_ICMP_CODES":       "true",
+				"C2C_ENFORCEMENT":         "both",
+				"WRITE_CONCURRENCY":       "16",
+				"KUBE_API_QPS":            "50",
+				"KUBE_API_BURST":          "100",
+				"DRIFT_POLICY":            "report",
 			}, &config.Config{
 				PolicyServerURL:       "http://example.com",
 				Namespace:             "custom-ns",
 				PollInterval:          42 * time.Second,
+				ReconcileDebounce:     3 * time.Second,
+				FullResyncInterval:    10 * time.Minute,
 				PerPageSecurityGroups: 77,
 				TLSCertPath:           "/custom/cert",
 				TLSKeyPath:            "/custom/key",
 				TLSCAPath:             "/custom/ca",
+				MetricsBindAddress:    ":9090",
+				HealthProbeAddress:    ":9091",
+				SyncStaleThreshold:    time.Hour,
+				CacheSyncTimeout:      30 * time.Second,
+
+				LeaderElection:          true,
+				LeaderElectionID:        "custom-leader",
+				LeaderElectionNamespace: "custom-lease-ns",
+				LeaseDuration:           30 * time.Second,
+				RenewDeadline:           20 * time.Second,
+				RetryPeriod:             5 * time.Second,
+
+				DeletionGuardMaxCount:   10,
+				DeletionGuardMaxPercent: 25,
+				DeletionGuardPasses:     5,
+
+				WorkloadNamespaces:    []string{"cf-workloads-a", "cf-workloads-b"},
+				ClusterwideGlobalASGs: true,
+				FQDNDestinations:      true,
+				StrictICMPCodes:       true,
+				C2CEnforcement:        config.C2CEnforcementBoth,
+				WriteConcurrency:      16,
+				KubeAPIQPS:            50,
+				KubeAPIBurst:          100,
+				DriftPolicy:           config.DriftPolicyReport,
 			}),
 			Entry("only required variable set, defaults applied", map[string]string{
 				"POLICY_SERVER_URL": "http://example.com",
@@ -55,10 +110,33 @@ var _ = Describe("Config", func() {
 				PolicyServerURL:       "http://example.com",
 				Namespace:             config.DefaultNamespace,
 				PollInterval:          config.DefaultPollInterval,
+				ReconcileDebounce:     config.DefaultReconcileDebounce,
+				FullResyncInterval:    config.DefaultFullResyncInterval,
 				PerPageSecurityGroups: config.DefaultPerPageSecurityGroups,
 				TLSCertPath:           config.DefaultTLSCertPath,
 				TLSKeyPath:            config.DefaultTLSKeyPath,
 				TLSCAPath:             config.DefaultTLSCAPath,
+				MetricsBindAddress:    config.DefaultMetricsBindAddress,
+				HealthProbeAddress:    config.DefaultHealthProbeAddress,
+				SyncStaleThreshold:    config.DefaultSyncStaleThreshold,
+				CacheSyncTimeout:      config.DefaultCacheSyncTimeout,
+
+				LeaderElection:   false,
+				LeaderElectionID: config.DefaultLeaderElectionID,
+				LeaseDuration:    config.DefaultLeaseDuration,
+				RenewDeadline:    config.DefaultRenewDeadline,
+				RetryPeriod:      config.DefaultRetryPeriod,
+
+				DeletionGuardMaxCount:   0,
+				DeletionGuardMaxPercent: config.DefaultDeletionGuardPercent,
+				DeletionGuardPasses:     config.DefaultDeletionGuardPasses,
+
+				WorkloadNamespaces: []string{config.DefaultNamespace},
+				C2CEnforcement:     config.DefaultC2CEnforcement,
+				WriteConcurrency:   config.DefaultWriteConcurrency,
+				KubeAPIQPS:         config.DefaultKubeAPIQPS,
+				KubeAPIBurst:       config.DefaultKubeAPIBurst,
+				DriftPolicy:        config.DefaultDriftPolicy,
 			}),
 		)
 
@@ -86,6 +164,54 @@ var _ = Describe("Config", func() {
 				setEnvWithCleanup("POLL_INTERVAL", "-5")
 				Expect(config.Load().PollInterval).To(Equal(config.DefaultPollInterval))
 			})
+
+			It("falls back when leader election is invalid", func() {
+				setEnvWithCleanup("LEADER_ELECTION", "notabool")
+				Expect(config.Load().LeaderElection).To(BeFalse())
+			})
+
+			It("falls back when reconcile debounce is invalid", func() {
+				setEnvWithCleanup("RECONCILE_DEBOUNCE", "notaduration")
+				Expect(config.Load().ReconcileDebounce).To(Equal(config.DefaultReconcileDebounce))
+			})
+
+			It("falls back when a deletion guard threshold is negative", func() {
+				setEnvWithCleanup("DELETION_GUARD_MAX_PERCENT", "-1")
+				Expect(config.Load().DeletionGuardMaxPercent).To(Equal(config.DefaultDeletionGuardPercent))
+			})
+		})
+
+		Describe("workload namespaces", func() {
+			BeforeEach(func() {
+				setEnvWithCleanup("POLICY_SERVER_URL", "http://example.com")
+			})
+
+			It("defaults to the namespace", func() {
+				setEnvWithCleanup("NAMESPACE", "custom-ns")
+				Expect(config.Load().WorkloadNamespaces).To(Equal([]string{"custom-ns"}))
+			})
+		})
+
+		Describe("C2C enforcement", func() {
+			BeforeEach(func() {
+				setEnvWithCleanup("POLICY_SERVER_URL", "http://example.com")
+			})
+
+			It("falls back to egress when the mode is unknown", func() {
+				setEnvWithCleanup("C2C_ENFORCEMENT", "sideways")
+				Expect(config.Load().C2CEnforcement).To(Equal(config.C2CEnforcementEgress))
+			})
+		})
+
+		Describe("drift policy", func() {
+			BeforeEach(func() {
+				setEnvWithCleanup("POLICY_SERVER_URL", "http://example.com")
+			})
+
+			It("falls back to reverting drift when the drift policy is unknown", func() {
+				setEnvWithCleanup("DRIFT_POLICY", "ignore")
+				Expect(config.Load().DriftPolicy).To(Equal(config.DriftPolicyRevert))
+			})
 		})
 
 		Describe("failure cases", func() {
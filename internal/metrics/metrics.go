@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "policy_agent"
+
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultSkipped = "skipped"
+)
+
+const (
+	OperationCreated   = "created"
+	OperationUpdated   = "updated"
+	OperationDeleted   = "deleted"
+	OperationUnchanged = "unchanged"
+	OperationDrifted   = "drifted"
+	OperationFailed    = "failed"
+)
+
+var (
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of reconcile passes, partitioned by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"result"})
+
+	LastSuccessfulReconcile = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_reconcile_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful reconcile pass.",
+	})
+
+	PolicyServerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "policy_server_request_duration_seconds",
+		Help:      "Duration of policy server requests, partitioned by call.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"call"})
+
+	PolicyServerRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_server_request_errors_total",
+		Help:      "Number of failed policy server requests, partitioned by call.",
+	}, []string{"call"})
+
+	NetworkPolicyOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "network_policy_operations_total",
+		Help:      "Number of CiliumNetworkPolicies created, updated, deleted, left unchanged, left drifted or failed to write.",
+	}, []string{"operation"})
+
+	SecurityGroups = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "security_groups",
+		Help:      "Number of application security groups observed in the last reconcile.",
+	})
+
+	C2CPolicies = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "c2c_policies",
+		Help:      "Number of container-to-container policies observed in the last reconcile.",
+	})
+
+	Spaces = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spaces",
+		Help:      "Number of space GUIDs observed on pods in the last reconcile.",
+	})
+
+	WithheldDeletions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "withheld_deletions",
+		Help:      "Number of obsolete CiliumNetworkPolicies whose deletion was withheld by the deletion guard in the last reconcile.",
+	})
+
+	TranslationDiagnostics = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "translation_diagnostics",
+		Help:      "Number of ASG rules (severity error) or rule entries (severity warning) dropped or widened during translation in the last reconcile, partitioned by field.",
+	}, []string{"field", "severity"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		ReconcileDuration,
+		LastSuccessfulReconcile,
+		PolicyServerRequestDuration,
+		PolicyServerRequestErrors,
+		NetworkPolicyOperations,
+		SecurityGroups,
+		C2CPolicies,
+		Spaces,
+		WithheldDeletions,
+		TranslationDiagnostics,
+	)
+}
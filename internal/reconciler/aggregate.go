@@ -0,0 +1,124 @@
+package reconciler
+
+import (
+	"net/netip"
+	"slices"
+
+	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
+)
+
+// aggregatePrefixes returns the smallest sorted set of canonical prefixes
+// covering exactly the addresses of the given prefixes. Duplicates and
+// prefixes contained in others are dropped and adjacent prefixes are merged.
+func aggregatePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := make([]netip.Prefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		sorted = append(sorted, prefix.Masked())
+	}
+	// IPv4 sorts before IPv6 and a prefix before the prefixes it contains
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	var aggregated []netip.Prefix
+	for _, prefix := range sorted {
+		if len(aggregated) > 0 && aggregated[len(aggregated)-1].Overlaps(prefix) {
+			continue
+		}
+		aggregated = append(aggregated, prefix)
+
+		// merging two siblings may make their parent the sibling of the
+		// previous prefix, so keep merging until no siblings are left
+		for len(aggregated) > 1 {
+			lower, upper := aggregated[len(aggregated)-2], aggregated[len(aggregated)-1]
+			parent, ok := siblingsParent(lower, upper)
+			if !ok {
+				break
+			}
+			aggregated = append(aggregated[:len(aggregated)-2], parent)
+		}
+	}
+	return aggregated
+}
+
+// siblingsParent returns the parent prefix if lower and upper are the two
+// halves of it.
+func siblingsParent(lower, upper netip.Prefix) (netip.Prefix, bool) {
+	if lower.Bits() != upper.Bits() || lower.Bits() == 0 || lower.Addr().BitLen() != upper.Addr().BitLen() {
+		return netip.Prefix{}, false
+	}
+	parent := netip.PrefixFrom(lower.Addr(), lower.Bits()-1).Masked()
+	if parent.Addr() != lower.Addr() || !parent.Contains(upper.Addr()) {
+		return netip.Prefix{}, false
+	}
+	return parent, true
+}
+
+// aggregateCIDRs canonicalises and aggregates CIDRs which were validated by
+// translateToCidrs.
+func aggregateCIDRs(cidrs []ciliumapi.CIDR) []ciliumapi.CIDR {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(string(cidr))
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	aggregated := []ciliumapi.CIDR{}
+	for _, prefix := range aggregatePrefixes(prefixes) {
+		aggregated = append(aggregated, ciliumapi.CIDR(prefix.String()))
+	}
+	return aggregated
+}
+
+// aggregateEgressRules merges CIDR rules and FQDN rules which only differ in
+// their destinations, so rules allowing the same ports and ICMP types are
+// rendered once. The order of the first occurrence of every rule is kept.
+func aggregateEgressRules(egressRules []ciliumapi.EgressRule) []ciliumapi.EgressRule {
+	var aggregated []ciliumapi.EgressRule
+	for _, egressRule := range egressRules {
+		i := slices.IndexFunc(aggregated, func(other ciliumapi.EgressRule) bool {
+			return sameExceptDestinations(&other, &egressRule)
+		})
+		if i == -1 {
+			aggregated = append(aggregated, *egressRule.DeepCopy())
+			continue
+		}
+
+		merged := &aggregated[i]
+		merged.ToCIDR = append(merged.ToCIDR, egressRule.ToCIDR...)
+		for _, fqdn := range egressRule.ToFQDNs {
+			if !slices.Contains(merged.ToFQDNs, fqdn) {
+				merged.ToFQDNs = append(merged.ToFQDNs, fqdn)
+			}
+		}
+	}
+
+	for i := range aggregated {
+		if len(aggregated[i].ToCIDR) > 0 {
+			aggregated[i].ToCIDR = aggregateCIDRs(aggregated[i].ToCIDR)
+		}
+	}
+	return aggregated
+}
+
+// sameExceptDestinations reports whether two rules are either both CIDR or
+// both FQDN rules and are equal apart from the CIDRs and FQDNs they allow.
+func sameExceptDestinations(a, b *ciliumapi.EgressRule) bool {
+	if (len(a.ToCIDR) > 0) != (len(b.ToCIDR) > 0) || (len(a.ToFQDNs) > 0) != (len(b.ToFQDNs) > 0) {
+		return false
+	}
+	if len(a.ToCIDR) == 0 && len(a.ToFQDNs) == 0 {
+		return false
+	}
+
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.ToCIDR, b.ToCIDR = nil, nil
+	a.ToFQDNs, b.ToFQDNs = nil, nil
+	return a.DeepEqual(b)
+}
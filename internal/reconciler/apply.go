@@ -0,0 +1,64 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FieldManager owns the fields of policies written by the agent.
+const FieldManager = "policy-agent"
+
+// apply writes the policy with server-side apply, taking ownership of every
+// rendered field from other field managers, and returns the policy as
+// returned by the API server.
+func (r *networkPolicyReconciler) apply(policy client.Object, opts ...client.ApplyOption) (client.Object, error) {
+	configuration, err := r.applyConfiguration(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, client.FieldOwner(FieldManager), client.ForceOwnership)
+	if err := r.k8sclient.Apply(context.Background(), client.ApplyConfigurationFromUnstructured(configuration), opts...); err != nil {
+		return nil, err
+	}
+
+	applied := emptyPolicyOf(policy)
+	if err := convert(configuration, applied); err != nil {
+		return nil, fmt.Errorf("not able to read applied %s: %w", kindOf(policy), err)
+	}
+	return applied, nil
+}
+
+// applyConfiguration returns the fields of the policy rendered by the agent.
+// Server-populated metadata is left out, so the agent never claims it.
+func (r *networkPolicyReconciler) applyConfiguration(policy client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := r.k8sclient.GroupVersionKindFor(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	configuration := &unstructured.Unstructured{}
+	if err := convert(policy, &configuration.Object); err != nil {
+		return nil, fmt.Errorf("not able to render %s for apply: %w", kindOf(policy), err)
+	}
+	configuration.SetGroupVersionKind(gvk)
+	configuration.SetResourceVersion("")
+	configuration.SetManagedFields(nil)
+	unstructured.RemoveNestedField(configuration.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(configuration.Object, "status")
+	return configuration, nil
+}
+
+// convert copies from into to through their JSON representation, which Cilium
+// policy rules customise.
+func convert(from, to any) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, to)
+}
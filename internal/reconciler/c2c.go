@@ -0,0 +1,143 @@
+package reconciler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	policy "code.cloudfoundry.org/policy_client"
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	slimv1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
+	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// c2cEgress reports whether C2C policies are enforced as egress rules of the
+// source apps.
+func (r *networkPolicyReconciler) c2cEgress() bool {
+	return r.config.C2CEnforcement != config.C2CEnforcementIngress
+}
+
+// c2cIngress reports whether C2C policies are enforced as ingress rules of
+// the destination apps.
+func (r *networkPolicyReconciler) c2cIngress() bool {
+	return r.config.C2CEnforcement == config.C2CEnforcementIngress || r.config.C2CEnforcement == config.C2CEnforcementBoth
+}
+
+func egressPolicyName(sourceID string) string {
+	return fmt.Sprintf("c2c-%s", sourceID)
+}
+
+func ingressPolicyName(destinationID string) string {
+	return fmt.Sprintf("c2c-ingress-%s", destinationID)
+}
+
+// policiesBySource groups C2C policies by source and destination app.
+func policiesBySource(networkPolicies []*policy.Policy) map[string]map[string][]policy.Destination {
+	aggregated := map[string]map[string][]policy.Destination{}
+	for _, p := range networkPolicies {
+		if _, exists := aggregated[p.Source.ID]; !exists {
+			aggregated[p.Source.ID] = map[string][]policy.Destination{}
+		}
+
+		aggregated[p.Source.ID][p.Destination.ID] = append(aggregated[p.Source.ID][p.Destination.ID], p.Destination)
+	}
+	return aggregated
+}
+
+// policiesByDestination groups C2C policies by destination and source app.
+func policiesByDestination(networkPolicies []*policy.Policy) map[string]map[string][]policy.Destination {
+	aggregated := map[string]map[string][]policy.Destination{}
+	for _, p := range networkPolicies {
+		if _, exists := aggregated[p.Destination.ID]; !exists {
+			aggregated[p.Destination.ID] = map[string][]policy.Destination{}
+		}
+
+		aggregated[p.Destination.ID][p.Source.ID] = append(aggregated[p.Destination.ID][p.Source.ID], p.Destination)
+	}
+	return aggregated
+}
+
+// appSelector selects the pods of an app in any workload namespace.
+func (r *networkPolicyReconciler) appSelector(appID string) *slimv1.LabelSelector {
+	selector := &slimv1.LabelSelector{
+		MatchLabels: map[string]string{
+			types.AppGUIDLabelKey: appID,
+		},
+	}
+	// endpoint selectors without a namespace only select endpoints in the
+	// namespace of the policy, peers may run in any workload namespace
+	if len(r.config.WorkloadNamespaces) > 1 {
+		selector.MatchExpressions = []slimv1.LabelSelectorRequirement{{
+			Key:      types.PodNamespaceLabelKey,
+			Operator: slimv1.LabelSelectorOpIn,
+			Values:   r.config.WorkloadNamespaces,
+		}}
+	}
+	return selector
+}
+
+// c2cPorts returns a port rule allowing the ports and protocols of the C2C
+// destinations.
+func c2cPorts(destinations []policy.Destination) ciliumapi.PortRules {
+	ports := []ciliumapi.PortProtocol{}
+	for _, dest := range destinations {
+		ports = append(ports, ciliumapi.PortProtocol{
+			Port:     fmt.Sprintf("%d", dest.Ports.Start),
+			EndPort:  int32(dest.Ports.End),
+			Protocol: ciliumapi.L4Proto(strings.ToUpper(dest.Protocol)),
+		})
+	}
+	return ciliumapi.PortRules{{Ports: ports}}
+}
+
+// translatePolicyToIngressCiliumNetworkPolicy allows ingress to the pods of
+// the destination app from the pods of every source app on the ports of its
+// C2C policies. The policy only adds allows and does not put the destination
+// app into default-deny ingress, so router and other ingress traffic keeps
+// flowing on clusters which are not default-deny.
+func (r *networkPolicyReconciler) translatePolicyToIngressCiliumNetworkPolicy(destinationID string, sourceMap map[string][]policy.Destination) (*ciliumv2.CiliumNetworkPolicy, error) {
+	ingressRules := []ciliumapi.IngressRule{}
+	for _, sourceID := range slices.Sorted(maps.Keys(sourceMap)) {
+		ingressRules = append(ingressRules, ciliumapi.IngressRule{
+			IngressCommonRule: ciliumapi.IngressCommonRule{
+				FromEndpoints: []ciliumapi.EndpointSelector{
+					{LabelSelector: r.appSelector(sourceID)},
+				},
+			},
+			ToPorts: c2cPorts(sourceMap[sourceID]),
+		})
+	}
+
+	return &ciliumv2.CiliumNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: ingressPolicyName(destinationID),
+			Labels: map[string]string{
+				types.NetworkPoliciesAppLabelKey: types.NetworkPoliciesAppLabelValue,
+			},
+			Annotations: map[string]string{
+				types.SourceHashAnnotationKey: c2cSourceHash(destinationID, sourceMap),
+			},
+		},
+		Specs: ciliumapi.Rules{
+			&ciliumapi.Rule{
+				EndpointSelector: ciliumapi.EndpointSelector{
+					LabelSelector: &slimv1.LabelSelector{
+						MatchLabels: map[string]string{
+							types.AppGUIDLabelKey: destinationID,
+						},
+					},
+				},
+				Ingress: ingressRules,
+				EnableDefaultDeny: ciliumapi.DefaultDenyConfig{
+					Ingress: ptr.To(false),
+				},
+			},
+		},
+	}, nil
+}
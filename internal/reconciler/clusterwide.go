@@ -0,0 +1,78 @@
+package reconciler
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	policy "code.cloudfoundry.org/policy_client"
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	slimv1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
+	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	kindCiliumNetworkPolicy            = "CiliumNetworkPolicy"
+	kindCiliumClusterwideNetworkPolicy = "CiliumClusterwideNetworkPolicy"
+)
+
+// clusterwide reports whether the ASG is rendered as a
+// CiliumClusterwideNetworkPolicy.
+func (r *networkPolicyReconciler) clusterwide(asg policy.SecurityGroup) bool {
+	return r.config.ClusterwideGlobalASGs && (asg.RunningDefault || asg.StagingDefault)
+}
+
+// clusterwidePolicy converts a translated ASG into a
+// CiliumClusterwideNetworkPolicy whose rules only select endpoints in the
+// workload namespaces.
+func (r *networkPolicyReconciler) clusterwidePolicy(cnp *ciliumv2.CiliumNetworkPolicy) *ciliumv2.CiliumClusterwideNetworkPolicy {
+	ccnp := &ciliumv2.CiliumClusterwideNetworkPolicy{
+		ObjectMeta: *cnp.ObjectMeta.DeepCopy(),
+		Specs:      cnp.Specs.DeepCopy(),
+	}
+
+	for _, spec := range ccnp.Specs {
+		spec.EndpointSelector.LabelSelector.MatchExpressions = append(spec.EndpointSelector.LabelSelector.MatchExpressions, slimv1.LabelSelectorRequirement{
+			Key:      types.PodNamespaceLabelKey,
+			Operator: slimv1.LabelSelectorOpIn,
+			Values:   r.config.WorkloadNamespaces,
+		})
+	}
+
+	return ccnp
+}
+
+func kindOf(obj client.Object) string {
+	if _, ok := obj.(*ciliumv2.CiliumClusterwideNetworkPolicy); ok {
+		return kindCiliumClusterwideNetworkPolicy
+	}
+	return kindCiliumNetworkPolicy
+}
+
+// specsOf returns the rules of either kind of managed policy.
+func specsOf(obj client.Object) ciliumapi.Rules {
+	switch policy := obj.(type) {
+	case *ciliumv2.CiliumNetworkPolicy:
+		return policy.Specs
+	case *ciliumv2.CiliumClusterwideNetworkPolicy:
+		return policy.Specs
+	}
+	return nil
+}
+
+// emptyPolicyOf returns an empty policy of the same kind to read into.
+func emptyPolicyOf(obj client.Object) client.Object {
+	if _, ok := obj.(*ciliumv2.CiliumClusterwideNetworkPolicy); ok {
+		return &ciliumv2.CiliumClusterwideNetworkPolicy{}
+	}
+	return &ciliumv2.CiliumNetworkPolicy{}
+}
+
+// describePolicy names the kind, name and namespace of a policy for errors.
+func describePolicy(obj client.Object) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s %q", kindOf(obj), obj.GetName())
+	}
+	return fmt.Sprintf("%s %q in namespace %q", kindOf(obj), obj.GetName(), obj.GetNamespace())
+}
@@ -0,0 +1,64 @@
+package reconciler
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeletionsWithheld is returned by Reconcile while the deletion guard
+// withholds the deletion of obsolete CiliumNetworkPolicies.
+var ErrDeletionsWithheld = errors.New("deletion of obsolete CiliumNetworkPolicies withheld by the deletion guard")
+
+// exceedsDeletionGuard reports whether deleting count of total managed
+// policies exceeds one of the configured thresholds.
+func (r *networkPolicyReconciler) exceedsDeletionGuard(count, total int) bool {
+	if count == 0 {
+		return false
+	}
+
+	if maxCount := r.config.DeletionGuardMaxCount; maxCount > 0 && count > maxCount {
+		return true
+	}
+
+	if maxPercent := r.config.DeletionGuardMaxPercent; maxPercent > 0 && count*100 > total*maxPercent {
+		return true
+	}
+
+	return false
+}
+
+// deletionGuardWindow is the minimum time deletions exceeding the guard are
+// withheld, so that passes triggered in quick succession, e.g. by pod churn
+// or retries, cannot satisfy the guard within seconds.
+func (r *networkPolicyReconciler) deletionGuardWindow() time.Duration {
+	return time.Duration(r.config.DeletionGuardPasses) * r.config.PollInterval
+}
+
+// withholdDeletions reports whether the deletion of count of total managed
+// policies has to be withheld. Deletions exceeding the guard are withheld
+// until the condition persisted for the configured number of consecutive
+// reconciles with fresh policy server data and for the deletion guard
+// window, which protects against transiently empty policy server responses
+// while still converging on intended mass deletions. Passes reusing cached
+// data are withheld without being counted.
+func (r *networkPolicyReconciler) withholdDeletions(count, total int, freshData bool) bool {
+	if !r.exceedsDeletionGuard(count, total) {
+		r.withheldPasses = 0
+		return false
+	}
+
+	if !freshData {
+		return true
+	}
+
+	if r.withheldPasses == 0 {
+		r.withheldSince = time.Now()
+	}
+	r.withheldPasses++
+	if r.withheldPasses >= r.config.DeletionGuardPasses && time.Since(r.withheldSince) >= r.deletionGuardWindow() {
+		r.withheldPasses = 0
+		return false
+	}
+
+	return true
+}
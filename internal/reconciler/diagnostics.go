@@ -0,0 +1,42 @@
+package reconciler
+
+type Severity string
+
+const (
+	// SeverityWarning marks an entry that was dropped or widened while the
+	// rest of the ASG rule was still translated.
+	SeverityWarning Severity = "warning"
+	// SeverityError marks an ASG rule that was dropped entirely.
+	SeverityError Severity = "error"
+)
+
+const (
+	FieldDestination = "destination"
+	FieldPorts       = "ports"
+	FieldProtocol    = "protocol"
+	FieldCode        = "code"
+)
+
+// Diagnostic describes a part of an ASG that could not be translated into
+// a Cilium egress rule.
+type Diagnostic struct {
+	ASGGUID   string
+	RuleIndex int
+	Field     string
+	Value     string
+	Reason    string
+	Severity  Severity
+}
+
+type Diagnostics []Diagnostic
+
+// Count returns the number of diagnostics with the given severity.
+func (d Diagnostics) Count(severity Severity) int {
+	count := 0
+	for _, diagnostic := range d {
+		if diagnostic.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
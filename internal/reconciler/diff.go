@@ -0,0 +1,81 @@
+package reconciler
+
+import (
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Diff is the difference between the desired policies and the managed
+// policies in the cluster. It is computed in memory, so it can be reported
+// or inspected before any policy is written.
+type Diff struct {
+	// Create holds desired policies which do not exist.
+	Create []client.Object
+	// Update holds desired policies whose rendered fields differ from the
+	// existing ones. The API server may still default them to the existing
+	// policies, which a dry run tells apart.
+	Update []PolicyUpdate
+	// Delete holds managed policies which are neither desired nor retained.
+	Delete []client.Object
+	// Unchanged holds desired policies matching the existing ones.
+	Unchanged []client.Object
+}
+
+// PolicyUpdate pairs an existing policy with the policy it is updated to.
+type PolicyUpdate struct {
+	Existing client.Object
+	Desired  client.Object
+	// Drifted is set if the existing policy was rendered from the same
+	// source as the desired one, but its specs were edited since.
+	Drifted bool
+}
+
+// NewDiff compares the desired and the actual policies by namespace and name,
+// where cluster-scoped policies have no namespace. Actual policies whose name
+// is retained are never deleted. The spec hashes of actual policies are
+// memoised in hashes, which may be nil.
+func NewDiff(desired, actual []client.Object, retained map[string]struct{}, hashes *SpecHashCache) Diff {
+	defer hashes.retain(actual)
+
+	existing := make(map[ktypes.NamespacedName]client.Object, len(actual))
+	for _, policy := range actual {
+		existing[client.ObjectKeyFromObject(policy)] = policy
+	}
+
+	var diff Diff
+	current := make(map[ktypes.NamespacedName]struct{}, len(desired))
+	for _, policy := range desired {
+		key := client.ObjectKeyFromObject(policy)
+		current[key] = struct{}{}
+
+		existingPolicy, exists := existing[key]
+		switch {
+		case !exists:
+			diff.Create = append(diff.Create, policy)
+		case hashes.unchangedByHash(existingPolicy, policy), policiesEqual(existingPolicy, policy):
+			diff.Unchanged = append(diff.Unchanged, policy)
+		default:
+			diff.Update = append(diff.Update, PolicyUpdate{
+				Existing: existingPolicy,
+				Desired:  policy,
+				Drifted:  hashesEqual(existingPolicy, policy) && hashes.drifted(existingPolicy),
+			})
+		}
+	}
+
+	for _, policy := range actual {
+		if _, exists := current[client.ObjectKeyFromObject(policy)]; exists {
+			continue
+		}
+		if _, exists := retained[policy.GetName()]; exists {
+			continue
+		}
+		diff.Delete = append(diff.Delete, policy)
+	}
+	return diff
+}
+
+// Changed reports whether writing the diff may change any policy.
+func (d Diff) Changed() bool {
+	return len(d.Create)+len(d.Update)+len(d.Delete) > 0
+}
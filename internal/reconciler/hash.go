@@ -0,0 +1,138 @@
+package reconciler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	policy "code.cloudfoundry.org/policy_client"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hashOf returns the hex encoded SHA-256 hash of the JSON representation of
+// v, which is stable as JSON objects are written with sorted map keys.
+func hashOf(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// asgSourceHash hashes the GUID, name, rules and bindings of an ASG. Space
+// GUIDs are sorted, so the order returned by the policy server does not
+// matter.
+func asgSourceHash(asg policy.SecurityGroup) string {
+	asg.StagingSpaceGuids = slices.Sorted(slices.Values(asg.StagingSpaceGuids))
+	asg.RunningSpaceGuids = slices.Sorted(slices.Values(asg.RunningSpaceGuids))
+	return hashOf(asg)
+}
+
+// c2cSourceHash hashes the app a C2C policy is rendered for and the
+// destinations of its peers.
+func c2cSourceHash(appID string, peers map[string][]policy.Destination) string {
+	return hashOf(struct {
+		App   string                          `json:"app"`
+		Peers map[string][]policy.Destination `json:"peers"`
+	}{appID, peers})
+}
+
+// specHash hashes the rendered specs of a policy.
+func specHash(obj client.Object) string {
+	return hashOf(specsOf(obj))
+}
+
+// annotateSpecHash annotates a desired policy with the hash of its specs.
+func annotateSpecHash(obj client.Object) {
+	annotations := maps.Clone(obj.GetAnnotations())
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[types.SpecHashAnnotationKey] = specHash(obj)
+	obj.SetAnnotations(annotations)
+}
+
+// hashesEqual reports whether the existing policy was written from the same
+// source and specs as the desired policy.
+func hashesEqual(existing, desired client.Object) bool {
+	existingAnnotations, desiredAnnotations := existing.GetAnnotations(), desired.GetAnnotations()
+	return existingAnnotations[types.SourceHashAnnotationKey] != "" &&
+		existingAnnotations[types.SourceHashAnnotationKey] == desiredAnnotations[types.SourceHashAnnotationKey] &&
+		existingAnnotations[types.SpecHashAnnotationKey] == desiredAnnotations[types.SpecHashAnnotationKey]
+}
+
+// SpecHashCache memoises the spec hashes of existing policies by UID and
+// resourceVersion, so that policies unchanged since the previous pass are
+// compared by their annotations only. A nil cache hashes every policy.
+type SpecHashCache struct {
+	mu     sync.Mutex
+	hashes map[ktypes.UID]cachedSpecHash
+}
+
+type cachedSpecHash struct {
+	resourceVersion string
+	hash            string
+}
+
+func NewSpecHashCache() *SpecHashCache {
+	return &SpecHashCache{hashes: map[ktypes.UID]cachedSpecHash{}}
+}
+
+// specHash returns the hash of the specs of an existing policy, which is only
+// computed again once the policy has a new resourceVersion.
+func (c *SpecHashCache) specHash(existing client.Object) string {
+	uid, resourceVersion := existing.GetUID(), existing.GetResourceVersion()
+	if c == nil || uid == "" || resourceVersion == "" {
+		return specHash(existing)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.hashes[uid]; ok && cached.resourceVersion == resourceVersion {
+		return cached.hash
+	}
+	hash := specHash(existing)
+	c.hashes[uid] = cachedSpecHash{resourceVersion: resourceVersion, hash: hash}
+	return hash
+}
+
+// retain forgets the hashes of policies which no longer exist.
+func (c *SpecHashCache) retain(existing []client.Object) {
+	if c == nil {
+		return
+	}
+	uids := make(map[ktypes.UID]struct{}, len(existing))
+	for _, obj := range existing {
+		uids[obj.GetUID()] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	maps.DeleteFunc(c.hashes, func(uid ktypes.UID, _ cachedSpecHash) bool {
+		_, exists := uids[uid]
+		return !exists
+	})
+}
+
+// drifted reports whether the specs of a policy were edited since the agent
+// wrote them.
+func (c *SpecHashCache) drifted(existing client.Object) bool {
+	annotated := existing.GetAnnotations()[types.SpecHashAnnotationKey]
+	return annotated != "" && c.specHash(existing) != annotated
+}
+
+// unchangedByHash reports whether the existing policy matches the desired
+// one without comparing their specs, as both were rendered from the same
+// source into the same specs which were not edited since.
+func (c *SpecHashCache) unchangedByHash(existing, desired client.Object) bool {
+	return hashesEqual(existing, desired) && !c.drifted(existing) &&
+		maps.Equal(managedLabels(existing), managedLabels(desired)) &&
+		maps.Equal(managedAnnotations(existing), managedAnnotations(desired))
+}
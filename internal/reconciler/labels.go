@@ -0,0 +1,59 @@
+package reconciler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// labelValueHashLength is the number of hex digits of the hash suffix which
+// keeps sanitised label values of different names apart.
+const labelValueHashLength = 8
+
+// SanitizeLabelValue returns a valid label value for any name. Valid names
+// are returned unchanged, otherwise invalid characters are replaced with "-",
+// the value is truncated and suffixed with a hash of the full name.
+func SanitizeLabelValue(name string) string {
+	if len(validation.IsValidLabelValue(name)) == 0 {
+		return name
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x80 && (isAlphanumeric(byte(r)) || r == '-' || r == '_' || r == '.') {
+			return r
+		}
+		return '-'
+	}, name)
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:labelValueHashLength]
+
+	// keep room for the separator and the hash suffix
+	sanitized = sanitized[:min(len(sanitized), validation.LabelValueMaxLength-labelValueHashLength-1)]
+	sanitized = strings.TrimFunc(sanitized, func(r rune) bool { return !isAlphanumeric(byte(r)) })
+	if sanitized == "" {
+		return suffix
+	}
+	return sanitized + "-" + suffix
+}
+
+func isAlphanumeric(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// managedLabels returns the labels owned by the agent, so that policies are
+// relabelled when they change.
+func managedLabels(policy client.Object) map[string]string {
+	labels := map[string]string{}
+	for _, key := range []string{types.NetworkPoliciesAppLabelKey, types.NetworkPoliciesRuleNameLabelKey} {
+		if value, ok := policy.GetLabels()[key]; ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
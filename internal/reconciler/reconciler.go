@@ -2,10 +2,17 @@ package reconciler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
 
 	"code.cloudfoundry.org/lager/v3"
@@ -13,183 +20,516 @@ import (
 	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
 	slimv1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
 	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/events"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type networkPolicyReconciler struct {
 	k8sclient client.Client
+	recorder  events.EventRecorder
 	config    *config.Config
 	logger    lager.Logger
+
+	// number of consecutive reconciles with fresh policy server data in
+	// which deletions exceeded the deletion guard, and the start of the
+	// first of them
+	withheldPasses int
+	withheldSince  time.Time
+
+	specHashes *SpecHashCache
 }
 
 type Reconciler interface {
-	Reconcile(securityGroups []policy.SecurityGroup, networkPolicies []*policy.Policy) error
+	Reconcile(securityGroups []policy.SecurityGroup, networkPolicies []*policy.Policy, workloads Workloads, opts ...ReconcileOption) error
+}
+
+// ErrPolicyFailed is matched by the errors Reconcile returns for single
+// policies which could not be translated, written or deleted. The other
+// policies of the pass are reconciled regardless.
+var ErrPolicyFailed = errors.New("policy not reconciled")
+
+// policyError marks the error of a single policy as ErrPolicyFailed without
+// changing its message.
+type policyError struct {
+	error
+}
+
+func (e policyError) Unwrap() error {
+	return e.error
+}
+
+func (e policyError) Is(target error) bool {
+	return target == ErrPolicyFailed
 }
 
-func New(k8sclient client.Client, config *config.Config, logger lager.Logger) Reconciler {
+// ReconcileOption configures a single reconcile pass.
+type ReconcileOption func(*reconcileOptions)
+
+type reconcileOptions struct {
+	cachedData bool
+}
+
+// WithCachedData marks a pass which reuses policy server data fetched by an
+// earlier pass. Such passes never count towards the deletion guard.
+func WithCachedData() ReconcileOption {
+	return func(o *reconcileOptions) {
+		o.cachedData = true
+	}
+}
+
+func New(k8sclient client.Client, recorder events.EventRecorder, config *config.Config, logger lager.Logger) Reconciler {
 	return &networkPolicyReconciler{
 		k8sclient: k8sclient,
+		recorder:  recorder,
 		config:    config,
 		logger:    logger,
+
+		specHashes: NewSpecHashCache(),
 	}
 }
 
-func (r *networkPolicyReconciler) Reconcile(securityGroups []policy.SecurityGroup, networkPolicies []*policy.Policy) error {
-	// Create a set of current security group GUIDs
-	currentGUIDs := map[string]struct{}{}
-	for _, asg := range securityGroups {
-		currentGUIDs[asg.Guid] = struct{}{}
+func (r *networkPolicyReconciler) Reconcile(securityGroups []policy.SecurityGroup, networkPolicies []*policy.Policy, workloads Workloads, opts ...ReconcileOption) (err error) {
+	options := &reconcileOptions{}
+	for _, opt := range opts {
+		opt(options)
 	}
 
-	aggregatePolicies := map[string]map[string][]policy.Destination{}
-	for _, p := range networkPolicies {
-		currentGUIDs[fmt.Sprintf("c2c-%s", p.Source.ID)] = struct{}{}
-
-		if _, exists := aggregatePolicies[p.Source.ID]; !exists {
-			aggregatePolicies[p.Source.ID] = map[string][]policy.Destination{}
-		}
-
-		aggregatePolicies[p.Source.ID][p.Destination.ID] = append(aggregatePolicies[p.Source.ID][p.Destination.ID], p.Destination)
+	status := &status{
+		securityGroups: len(securityGroups),
+		c2cPolicies:    len(networkPolicies),
 	}
+	defer func() { r.recordStatus(status, err) }()
 
-	err := r.removeObsoleteNetworkPolicies(currentGUIDs)
-	if err != nil {
-		r.logger.Error("failed to remove obsolete network policies", err)
-		return err
+	var egressPolicies, ingressPolicies map[string]map[string][]policy.Destination
+	if r.c2cEgress() {
+		egressPolicies = policiesBySource(networkPolicies)
 	}
+	if r.c2cIngress() {
+		ingressPolicies = policiesByDestination(networkPolicies)
+	}
+
+	// every object is reconciled on its own, so that a single failing policy
+	// does not keep the others from converging
+	var errs []error
 
+	// policies which fail to translate keep their existing
+	// CiliumNetworkPolicies in every namespace
+	var desired []client.Object
+	retained := map[string]struct{}{}
+
+	var diagnostics Diagnostics
 	for _, asg := range securityGroups {
-		cnp, err := r.translasteASGtoCiliumNetworkPolicy(asg)
+		cnp, asgDiagnostics, err := r.translasteASGtoCiliumNetworkPolicy(asg)
+		diagnostics = append(diagnostics, asgDiagnostics...)
 		if err != nil {
-			return fmt.Errorf("not able to translate ASG '%v': %w", asg, err)
+			r.logger.Error("failed to translate ASG", err, lager.Data{"asg_guid": asg.Guid, "asg_name": asg.Name})
+			errs = append(errs, policyError{fmt.Errorf("not able to translate ASG %q: %w", asg.Guid, err)})
+			status.failed++
+			retained[asg.Guid] = struct{}{}
+			continue
 		}
 
-		if err := r.createOrUpdateNetworkPolicy(cnp); err != nil {
-			r.logger.Error("failed to create/update CiliumNetworkPolicy", err, lager.Data{"asg_name": asg.Name})
-			return err
+		if r.clusterwide(asg) {
+			desired = append(desired, r.clusterwidePolicy(cnp))
+			continue
 		}
+
+		desired = append(desired, inNamespaces(cnp, r.namespacesForASG(asg, workloads))...)
 	}
+	recordDiagnostics(diagnostics)
 
-	for sourceID, destinations := range aggregatePolicies {
+	for sourceID, destinations := range egressPolicies {
 		cnp, err := r.translatePolicyToCiliumNetworkPolicy(sourceID, destinations)
 		if err != nil {
-			return fmt.Errorf("not able to translate Policy for app %q: %w", sourceID, err)
+			r.logger.Error("failed to translate Policy", err, lager.Data{"policy_source_id": sourceID})
+			errs = append(errs, policyError{fmt.Errorf("not able to translate Policy for app %q: %w", sourceID, err)})
+			status.failed++
+			retained[egressPolicyName(sourceID)] = struct{}{}
+			continue
 		}
 
-		if err := r.createOrUpdateNetworkPolicy(cnp); err != nil {
-			r.logger.Error("failed to create/update CiliumNetworkPolicy", err, lager.Data{"policy_source_id": sourceID})
-			return err
+		desired = append(desired, inNamespaces(cnp, r.workloadNamespaces(workloads.namespacesHostingApp(sourceID)))...)
+	}
+
+	for destinationID, sources := range ingressPolicies {
+		cnp, err := r.translatePolicyToIngressCiliumNetworkPolicy(destinationID, sources)
+		if err != nil {
+			r.logger.Error("failed to translate ingress Policy", err, lager.Data{"policy_destination_id": destinationID})
+			errs = append(errs, policyError{fmt.Errorf("not able to translate ingress Policy for app %q: %w", destinationID, err)})
+			status.failed++
+			retained[ingressPolicyName(destinationID)] = struct{}{}
+			continue
 		}
+
+		desired = append(desired, inNamespaces(cnp, r.workloadNamespaces(workloads.namespacesHostingApp(destinationID)))...)
 	}
 
-	return nil
+	for _, policy := range desired {
+		annotateSpecHash(policy)
+	}
+
+	// the managed policies are listed once from the informer cache, so that
+	// requests are only sent for policies which change
+	actual, err := r.listManagedNetworkPolicies()
+	if err != nil {
+		status.failed++
+		return errors.Join(append(errs, err)...)
+	}
+
+	diff := NewDiff(desired, actual, retained, r.specHashes)
+	summary := lager.Data{
+		"create":    len(diff.Create),
+		"update":    len(diff.Update),
+		"delete":    len(diff.Delete),
+		"unchanged": len(diff.Unchanged),
+	}
+	if diff.Changed() {
+		r.logger.Info("applying policy diff", summary)
+	} else {
+		r.logger.Debug("policies up to date", summary)
+	}
+
+	errs = append(errs, r.removeObsoleteNetworkPolicies(diff.Delete, len(actual), !options.cachedData, status)...)
+	errs = append(errs, r.writeNetworkPolicies(diff, status)...)
+
+	return errors.Join(errs...)
 }
 
-func (r *networkPolicyReconciler) removeObsoleteNetworkPolicies(currentGUIDs map[string]struct{}) error {
-	policies := &ciliumv2.CiliumNetworkPolicyList{}
-	if err := r.k8sclient.List(context.Background(), policies, &client.ListOptions{
-		LabelSelector: labels.SelectorFromValidatedSet(map[string]string{types.NetworkPoliciesAppLabelKey: types.NetworkPoliciesAppLabelValue}),
-	}); err != nil {
-		r.logger.Error("failed to list CiliumNetworkPolicies", err)
-		return err
+// writeNetworkPolicies creates and updates the policies of the diff with a
+// bounded number of workers, so that large foundations are not reconciled
+// one request at a time, and returns one error per policy that could not be
+// written.
+func (r *networkPolicyReconciler) writeNetworkPolicies(diff Diff, status *status) []error {
+	for _, policy := range diff.Unchanged {
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationUnchanged).Inc()
+		r.logger.Debug("unchanged policy, no update necessary", lager.Data{"kind": kindOf(policy), "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		status.count(metrics.OperationUnchanged, policy)
 	}
 
-	// Delete only policies whose names (GUIDs) are not in the current security groups
-	for _, policy := range policies.Items {
-		if _, exists := currentGUIDs[policy.Name]; !exists {
-			err := r.k8sclient.Delete(context.Background(), &policy)
+	var (
+		errs    []error
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, max(r.config.WriteConcurrency, 1))
+	)
+	write := func(policy client.Object, write func() (string, error)) {
+		workers <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-workers }()
+
+			operation, err := write()
+
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				r.logger.Error("failed to delete obsolete CiliumNetworkPolicy", err, lager.Data{"policy_name": policy.Name})
-				return err
+				r.logger.Error("failed to create/update policy", err, lager.Data{"kind": kindOf(policy), "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+				errs = append(errs, policyError{fmt.Errorf("not able to apply %s: %w", describePolicy(policy), err)})
+				status.failed++
+				return
 			}
-			r.logger.Info("deleted obsolete CiliumNetworkPolicy", lager.Data{"policy_name": policy.Name})
+			status.count(operation, policy)
+		})
+	}
+
+	for _, policy := range diff.Create {
+		write(policy, func() (string, error) { return r.createNetworkPolicy(policy) })
+	}
+	for _, update := range diff.Update {
+		write(update.Desired, func() (string, error) { return r.updateNetworkPolicy(update) })
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// namespacesForASG returns the workload namespaces an ASG applies to, which
+// are all of them for globally bound ASGs and otherwise those hosting pods of
+// the ASG's spaces.
+func (r *networkPolicyReconciler) namespacesForASG(asg policy.SecurityGroup, workloads Workloads) []string {
+	if asg.RunningDefault || asg.StagingDefault {
+		return r.config.WorkloadNamespaces
+	}
+
+	return r.workloadNamespaces(workloads.namespacesHostingSpaces(slices.Concat(asg.RunningSpaceGuids, asg.StagingSpaceGuids)...))
+}
+
+// workloadNamespaces drops namespaces which are not configured as workload
+// namespaces.
+func (r *networkPolicyReconciler) workloadNamespaces(namespaces []string) []string {
+	return slices.DeleteFunc(namespaces, func(namespace string) bool {
+		return !slices.Contains(r.config.WorkloadNamespaces, namespace)
+	})
+}
+
+// inNamespaces returns a copy of the CiliumNetworkPolicy for every namespace.
+func inNamespaces(cnp *ciliumv2.CiliumNetworkPolicy, namespaces []string) []client.Object {
+	cnps := make([]client.Object, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		namespaced := cnp.DeepCopy()
+		namespaced.Namespace = namespace
+		cnps = append(cnps, namespaced)
+	}
+	return cnps
+}
+
+// listManagedNetworkPolicies lists every managed CiliumNetworkPolicy in the
+// workload namespaces and every managed CiliumClusterwideNetworkPolicy, which
+// are listed even if global ASGs are rendered namespaced, so that they are
+// deleted once the clusterwide mode is turned off.
+func (r *networkPolicyReconciler) listManagedNetworkPolicies() ([]client.Object, error) {
+	managedSelector := labels.SelectorFromValidatedSet(map[string]string{types.NetworkPoliciesAppLabelKey: types.NetworkPoliciesAppLabelValue})
+
+	var policies []client.Object
+	for _, namespace := range r.config.WorkloadNamespaces {
+		namespacePolicies := &ciliumv2.CiliumNetworkPolicyList{}
+		if err := r.k8sclient.List(context.Background(), namespacePolicies, &client.ListOptions{
+			Namespace:     namespace,
+			LabelSelector: managedSelector,
+		}); err != nil {
+			r.logger.Error("failed to list CiliumNetworkPolicies", err, lager.Data{"namespace": namespace})
+			return nil, fmt.Errorf("not able to list CiliumNetworkPolicies in namespace %q: %w", namespace, err)
+		}
+		for i := range namespacePolicies.Items {
+			policies = append(policies, &namespacePolicies.Items[i])
+		}
+	}
+
+	clusterwidePolicies := &ciliumv2.CiliumClusterwideNetworkPolicyList{}
+	if err := r.k8sclient.List(context.Background(), clusterwidePolicies, &client.ListOptions{
+		LabelSelector: managedSelector,
+	}); err != nil {
+		r.logger.Error("failed to list CiliumClusterwideNetworkPolicies", err)
+		return nil, fmt.Errorf("not able to list CiliumClusterwideNetworkPolicies: %w", err)
+	}
+	for i := range clusterwidePolicies.Items {
+		policies = append(policies, &clusterwidePolicies.Items[i])
+	}
+	return policies, nil
+}
+
+// removeObsoleteNetworkPolicies deletes the obsolete policies, unless the
+// deletion guard withholds the deletions, and returns one error per policy
+// that could not be deleted. Policies annotated to allow their deletion
+// bypass the guard.
+func (r *networkPolicyReconciler) removeObsoleteNetworkPolicies(obsolete []client.Object, managed int, freshData bool, status *status) []error {
+	var allowed, guarded []client.Object
+	for _, policy := range obsolete {
+		if policy.GetAnnotations()[types.AllowDeletionAnnotationKey] == "true" {
+			allowed = append(allowed, policy)
+		} else {
+			guarded = append(guarded, policy)
+		}
+	}
+
+	var errs []error
+	if r.withholdDeletions(len(guarded), managed, freshData) {
+		r.logger.Info("withholding deletion of obsolete CiliumNetworkPolicies exceeding the deletion guard", lager.Data{
+			"obsolete":           len(guarded),
+			"managed":            managed,
+			"max_count":          r.config.DeletionGuardMaxCount,
+			"max_percent":        r.config.DeletionGuardMaxPercent,
+			"consecutive_passes": r.withheldPasses,
+			"required_passes":    r.config.DeletionGuardPasses,
+			"withheld_since":     r.withheldSince,
+			"required_window":    r.deletionGuardWindow(),
+		})
+		status.withheld = len(guarded)
+		errs = append(errs, fmt.Errorf("%w: %d of %d policies", ErrDeletionsWithheld, len(guarded), managed))
+		guarded = nil
+	}
+	metrics.WithheldDeletions.Set(float64(status.withheld))
+
+	for _, policy := range append(allowed, guarded...) {
+		kind := kindOf(policy)
+		// the informer cache may still list a policy which is already
+		// deleted
+		err := client.IgnoreNotFound(r.k8sclient.Delete(context.Background(), policy))
+		if err != nil {
+			r.logger.Error("failed to delete obsolete policy", err, lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+			r.recorder.Eventf(policy, nil, corev1.EventTypeWarning, ReasonDeleteFailed, ActionDelete, "failed to delete obsolete %s: %v", kind, err)
+			metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationFailed).Inc()
+			status.failed++
+			errs = append(errs, policyError{fmt.Errorf("not able to delete %s: %w", describePolicy(policy), err)})
+			continue
 		}
+		status.deleted++
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationDeleted).Inc()
+		r.logger.Info("deleted obsolete policy", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		r.recorder.Eventf(policy, nil, corev1.EventTypeNormal, ReasonDeleted, ActionDelete, "deleted obsolete %s", kind)
 	}
 
-	return nil
+	return errs
 }
 
-func (r *networkPolicyReconciler) translasteASGtoCiliumNetworkPolicy(asg policy.SecurityGroup) (*ciliumv2.CiliumNetworkPolicy, error) {
-	egressRules := CreateCiliumEgressRulesFromASG(asg.Rules)
+const maxLogValueLength = 32
+
+func (r *networkPolicyReconciler) translasteASGtoCiliumNetworkPolicy(asg policy.SecurityGroup) (*ciliumv2.CiliumNetworkPolicy, Diagnostics, error) {
+	translatedRules, diagnostics := TranslateASGRules(asg, TranslationOptions{
+		FQDNDestinations: r.config.FQDNDestinations,
+		StrictICMPCodes:  r.config.StrictICMPCodes,
+	})
+	r.reportDiagnostics(asg, diagnostics)
+
+	// rules with the log flag are kept in a separate spec so that Hubble
+	// flows they allow carry the log value of that spec only
+	var egressRules, loggedEgressRules, allEgressRules []ciliumapi.EgressRule
+	for _, translated := range translatedRules {
+		if translated.Log {
+			loggedEgressRules = append(loggedEgressRules, translated.Egress...)
+		} else {
+			egressRules = append(egressRules, translated.Egress...)
+		}
+		allEgressRules = append(allEgressRules, translated.Egress...)
+	}
+	egressRules = WithDNSVisibility(aggregateEgressRules(egressRules), allEgressRules)
+	loggedEgressRules = aggregateEgressRules(loggedEgressRules)
 
 	specs := ciliumapi.Rules{}
 	for _, selector := range CreateCiliumEgressSelectorsFromASG(asg) {
-		specs = append(specs,
-			&ciliumapi.Rule{
-				Egress:           egressRules,
-				EndpointSelector: ciliumapi.EndpointSelector{LabelSelector: &selector},
-			},
-		)
+		// an ASG whose rules are all logged has no unlogged spec
+		if len(egressRules) > 0 || len(loggedEgressRules) == 0 {
+			specs = append(specs,
+				&ciliumapi.Rule{
+					Egress:           egressRules,
+					EndpointSelector: ciliumapi.EndpointSelector{LabelSelector: &selector},
+				},
+			)
+		}
+		if len(loggedEgressRules) > 0 {
+			specs = append(specs,
+				&ciliumapi.Rule{
+					Egress:           loggedEgressRules,
+					EndpointSelector: ciliumapi.EndpointSelector{LabelSelector: selector.DeepCopy()},
+					Description:      fmt.Sprintf("logged rules of ASG %s", asg.Name),
+					Log:              ciliumapi.LogConfig{Value: logValue(asg.Name)},
+				},
+			)
+		}
 	}
 
 	if len(specs) == 0 {
-		return nil, fmt.Errorf("no specs created")
+		return nil, diagnostics, fmt.Errorf("no specs created")
 	}
 
 	cnp := &ciliumv2.CiliumNetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      asg.Guid,
-			Namespace: r.config.Namespace,
+			Name: asg.Guid,
 			Labels: map[string]string{
 				types.NetworkPoliciesAppLabelKey:      types.NetworkPoliciesAppLabelValue,
-				types.NetworkPoliciesRuleNameLabelKey: asg.Name,
+				types.NetworkPoliciesRuleNameLabelKey: SanitizeLabelValue(asg.Name),
 			},
+			Annotations: asgAnnotations(asg, translatedRules, diagnostics),
 		},
 		Specs: specs,
 	}
-	return cnp, nil
+	return cnp, diagnostics, nil
+}
+
+// asgAnnotations returns the annotations carrying the source hash, the name,
+// if it is no valid label value, the rule descriptions and the translation
+// diagnostics of an ASG.
+func asgAnnotations(asg policy.SecurityGroup, translatedRules []TranslatedRule, diagnostics Diagnostics) map[string]string {
+	annotations := map[string]string{
+		types.SourceHashAnnotationKey: asgSourceHash(asg),
+	}
+	maps.Copy(annotations, diagnosticsAnnotations(diagnostics))
+	if SanitizeLabelValue(asg.Name) != asg.Name {
+		annotations[types.RuleNameAnnotationKey] = asg.Name
+	}
+	for _, translated := range translatedRules {
+		if translated.Description != "" {
+			annotations[types.RuleDescriptionAnnotationKey(translated.Index)] = translated.Description
+		}
+	}
+	return annotations
+}
+
+// logValue derives the Cilium log value, which is limited to 32 printable
+// ASCII characters, from the name of an ASG.
+func logValue(name string) string {
+	value := make([]byte, 0, maxLogValueLength)
+	for i := 0; i < len(name) && len(value) < maxLogValueLength; i++ {
+		if name[i] >= ' ' && name[i] <= '~' {
+			value = append(value, name[i])
+		}
+	}
+	return string(value)
+}
+
+func (r *networkPolicyReconciler) reportDiagnostics(asg policy.SecurityGroup, diagnostics Diagnostics) {
+	for _, diagnostic := range diagnostics {
+		r.logger.Info("ASG rule entry not translated as specified", lager.Data{
+			"asg_guid":   asg.Guid,
+			"asg_name":   asg.Name,
+			"rule_index": diagnostic.RuleIndex,
+			"field":      diagnostic.Field,
+			"value":      diagnostic.Value,
+			"reason":     diagnostic.Reason,
+			"severity":   diagnostic.Severity,
+		})
+	}
+}
+
+// recordDiagnostics sets the translation diagnostics metric to the
+// diagnostics of the current pass, so that ASGs which do not change are not
+// counted again on every pass.
+func recordDiagnostics(diagnostics Diagnostics) {
+	counts := map[[2]string]int{}
+	for _, diagnostic := range diagnostics {
+		counts[[2]string{diagnostic.Field, string(diagnostic.Severity)}]++
+	}
+
+	metrics.TranslationDiagnostics.Reset()
+	for labels, count := range counts {
+		metrics.TranslationDiagnostics.WithLabelValues(labels[0], labels[1]).Set(float64(count))
+	}
+}
+
+// diagnosticsAnnotations returns the annotations summarising translation
+// diagnostics, or nil if the ASG was translated without any.
+func diagnosticsAnnotations(diagnostics Diagnostics) map[string]string {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	return map[string]string{
+		types.TranslationWarningsAnnotationKey: strconv.Itoa(diagnostics.Count(SeverityWarning)),
+		types.TranslationErrorsAnnotationKey:   strconv.Itoa(diagnostics.Count(SeverityError)),
+	}
 }
 
 func (r *networkPolicyReconciler) translatePolicyToCiliumNetworkPolicy(sourceID string, destinationMap map[string][]policy.Destination) (*ciliumv2.CiliumNetworkPolicy, error) {
 	egressRules := []ciliumapi.EgressRule{}
-	for destinationID, destinations := range destinationMap {
-		egressRule := ciliumapi.EgressRule{
+	for _, destinationID := range slices.Sorted(maps.Keys(destinationMap)) {
+		egressRules = append(egressRules, ciliumapi.EgressRule{
 			EgressCommonRule: ciliumapi.EgressCommonRule{
 				ToEndpoints: []ciliumapi.EndpointSelector{
-					{
-						LabelSelector: &slimv1.LabelSelector{
-							MatchLabels: map[string]string{
-								"cloudfoundry.org/app-guid": destinationID,
-							},
-						},
-					},
-				},
-			},
-			ToPorts: ciliumapi.PortRules{
-				{
-					Ports: []ciliumapi.PortProtocol{},
+					{LabelSelector: r.appSelector(destinationID)},
 				},
 			},
-		}
-
-		for _, dest := range destinations {
-			egressRule.ToPorts[0].Ports = append(egressRule.ToPorts[0].Ports, ciliumapi.PortProtocol{
-				Port:     fmt.Sprintf("%d", dest.Ports.Start),
-				EndPort:  int32(dest.Ports.End),
-				Protocol: ciliumapi.L4Proto(strings.ToUpper(dest.Protocol)),
-			})
-		}
-
-		egressRules = append(egressRules, egressRule)
+			ToPorts: c2cPorts(destinationMap[destinationID]),
+		})
 	}
 
 	return &ciliumv2.CiliumNetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("c2c-%s", sourceID),
-			Namespace: r.config.Namespace,
+			Name: egressPolicyName(sourceID),
 			Labels: map[string]string{
 				types.NetworkPoliciesAppLabelKey: types.NetworkPoliciesAppLabelValue,
 			},
+			Annotations: map[string]string{
+				types.SourceHashAnnotationKey: c2cSourceHash(sourceID, destinationMap),
+			},
 		},
 		Specs: ciliumapi.Rules{
 			&ciliumapi.Rule{
 				EndpointSelector: ciliumapi.EndpointSelector{
 					LabelSelector: &slimv1.LabelSelector{
 						MatchLabels: map[string]string{
-							"cloudfoundry.org/app-guid": sourceID,
+							types.AppGUIDLabelKey: sourceID,
 						},
 					},
 				},
@@ -199,39 +539,102 @@ func (r *networkPolicyReconciler) translatePolicyToCiliumNetworkPolicy(sourceID
 	}, nil
 }
 
-func (r *networkPolicyReconciler) createOrUpdateNetworkPolicy(cnp *ciliumv2.CiliumNetworkPolicy) error {
-	existing := &ciliumv2.CiliumNetworkPolicy{}
-	if err := r.k8sclient.Get(context.Background(), client.ObjectKeyFromObject(cnp), existing); err != nil {
-		if !apierrors.IsNotFound(err) {
-			r.logger.Error("failed to get existing CiliumNetworkPolicy", err)
-			return err
-		}
+// createNetworkPolicy applies a CiliumNetworkPolicy or
+// CiliumClusterwideNetworkPolicy which does not exist yet.
+func (r *networkPolicyReconciler) createNetworkPolicy(policy client.Object) (string, error) {
+	kind := kindOf(policy)
+	created, err := r.apply(policy)
+	if err != nil {
+		r.logger.Error("failed to create policy", err, lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		r.recorder.Eventf(policy, nil, corev1.EventTypeWarning, ReasonCreateFailed, ActionCreate, "failed to create %s: %v", kind, err)
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationFailed).Inc()
+		return "", err
+	}
 
-		if err := r.k8sclient.Create(context.Background(), cnp); err != nil {
-			r.logger.Error("failed to create CiliumNetworkPolicy", err)
-			return err
-		}
+	metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationCreated).Inc()
+	r.logger.Info("created policy", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+	r.recorder.Eventf(created, nil, corev1.EventTypeNormal, ReasonCreated, ActionCreate, "created %s", kind)
+	r.recordTranslationEvent(created)
+	return metrics.OperationCreated, nil
+}
 
-		r.logger.Info("created CiliumNetworkPolicy", lager.Data{"asg_guid": cnp.Name})
-		return nil
+// updateNetworkPolicy applies a CiliumNetworkPolicy or
+// CiliumClusterwideNetworkPolicy which differs from the existing one and
+// returns the operation performed. Manual edits of the specs are only
+// reported if the drift policy says so.
+func (r *networkPolicyReconciler) updateNetworkPolicy(update PolicyUpdate) (string, error) {
+	existing, policy := update.Existing, update.Desired
+	kind := kindOf(policy)
+
+	// a dry run returns the policy as the API server would store it, so
+	// defaulting does not make unchanged policies look different
+	applied, err := r.apply(policy, client.DryRunAll)
+	if err != nil {
+		r.logger.Error("failed to dry-run apply policy", err, lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationFailed).Inc()
+		return "", err
 	}
 
-	cnp.ResourceVersion = existing.ResourceVersion
+	if policiesEqual(existing, applied) {
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationUnchanged).Inc()
+		r.logger.Debug("unchanged policy, no update necessary", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		return metrics.OperationUnchanged, nil
+	}
 
-	if specsEqual(existing, cnp) {
-		r.logger.Debug("unchanged CiliumNetworkPolicy, no update necessary", lager.Data{"asg_guid": cnp.Name})
-		return nil
+	if update.Drifted && r.config.DriftPolicy == config.DriftPolicyReport {
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationDrifted).Inc()
+		r.logger.Info("specs of policy were edited, leaving them as edited", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		r.recorder.Eventf(existing, nil, corev1.EventTypeWarning, ReasonDriftDetected, ActionUpdate, "specs of %s were edited and differ from the rendered ones", kind)
+		return metrics.OperationDrifted, nil
+	}
+
+	updated, err := r.apply(policy)
+	if err != nil {
+		r.logger.Error("failed to update policy", err, lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		r.recorder.Eventf(existing, nil, corev1.EventTypeWarning, ReasonUpdateFailed, ActionUpdate, "failed to update %s: %v", kind, err)
+		metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationFailed).Inc()
+		return "", err
+	}
+
+	metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationUpdated).Inc()
+	r.logger.Debug("updated policy", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+	r.recorder.Eventf(updated, nil, corev1.EventTypeNormal, ReasonUpdated, ActionUpdate, "updated %s", kind)
+	if update.Drifted {
+		r.logger.Info("reverted edited specs of policy", lager.Data{"kind": kind, "policy_name": policy.GetName(), "namespace": policy.GetNamespace()})
+		r.recorder.Eventf(updated, nil, corev1.EventTypeWarning, ReasonDriftReverted, ActionUpdate, "reverted edited specs of %s", kind)
 	}
+	r.recordTranslationEvent(updated)
+	return metrics.OperationUpdated, nil
+}
 
-	if err := r.k8sclient.Update(context.Background(), cnp); err != nil {
-		r.logger.Error("failed to update CiliumNetworkPolicy", err)
-		return err
+// recordTranslationEvent records a warning on a written policy whose ASG had
+// rule entries dropped during translation.
+func (r *networkPolicyReconciler) recordTranslationEvent(policy client.Object) {
+	annotations := policy.GetAnnotations()
+	warnings, errors := annotations[types.TranslationWarningsAnnotationKey], annotations[types.TranslationErrorsAnnotationKey]
+	if warnings == "" && errors == "" {
+		return
 	}
 
-	r.logger.Debug("updated CiliumNetworkPolicy", lager.Data{"asg_guid": cnp.Name})
-	return nil
+	r.recorder.Eventf(policy, nil, corev1.EventTypeWarning, ReasonTranslationDiagnostics, ActionTranslate,
+		"dropped %s rule entries and %s rules of the ASG during translation, see agent logs for details", warnings, errors)
 }
 
-func specsEqual(a, b *ciliumv2.CiliumNetworkPolicy) bool {
-	return a.Specs.DeepEqual(&b.Specs)
+// policiesEqual compares the specs and the labels and annotations owned by
+// the agent.
+func policiesEqual(a, b client.Object) bool {
+	aSpecs, bSpecs := specsOf(a), specsOf(b)
+	return aSpecs.DeepEqual(&bSpecs) &&
+		maps.Equal(managedLabels(a), managedLabels(b)) &&
+		maps.Equal(managedAnnotations(a), managedAnnotations(b))
+}
+
+func managedAnnotations(policy client.Object) map[string]string {
+	annotations := map[string]string{}
+	for key, value := range policy.GetAnnotations() {
+		if strings.HasPrefix(key, types.AnnotationPrefix) && key != types.AllowDeletionAnnotationKey {
+			annotations[key] = value
+		}
+	}
+	return annotations
 }
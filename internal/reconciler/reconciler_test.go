@@ -3,9 +3,20 @@ package reconciler_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	agentconfig "code.cloudfoundry.org/k8s-policy-agent/internal/config"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
 	"code.cloudfoundry.org/k8s-policy-agent/internal/reconciler"
 
 	"code.cloudfoundry.org/lager/v3"
@@ -16,24 +27,99 @@ import (
 	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	. "github.com/onsi/gomega/gstruct"
+	"github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
 )
 
 func init() {
 	utilruntime.Must(ciliumv2.AddToScheme(scheme.Scheme))
 }
 
+func newFakeClient(objs ...ctrlclient.Object) ctrlclient.WithWatch {
+	return fake.NewClientBuilder().
+		WithObjects(objs...).
+		WithInterceptorFuncs(interceptor.Funcs{Apply: applyUnlessDryRun}).
+		Build()
+}
+
+// applyUnlessDryRun applies dry runs of server-side apply to a copy of the
+// existing object, which the fake client would otherwise write, so that they
+// return the merged object like the API server does.
+func applyUnlessDryRun(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+	applyOptions := &ctrlclient.ApplyOptions{}
+	applyOptions.ApplyOptions(opts)
+	if !slices.Contains(applyOptions.DryRun, metav1.DryRunAll) {
+		return c.Apply(ctx, obj, opts...)
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	configuration := &unstructured.Unstructured{}
+	if err := configuration.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(configuration.GroupVersionKind())
+	scratch := fake.NewClientBuilder()
+	switch err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(configuration), existing); {
+	case err == nil:
+		scratch = scratch.WithObjects(existing)
+	case !apierrors.IsNotFound(err):
+		return err
+	}
+	return scratch.Build().Apply(ctx, obj, slices.DeleteFunc(opts, func(opt ctrlclient.ApplyOption) bool {
+		return opt == ctrlclient.DryRunAll
+	})...)
+}
+
+// regardingRecorder records the reason of every event along with the object
+// it is recorded against.
+type regardingRecorder struct {
+	mu        sync.Mutex
+	regarding map[string][]metav1.Object
+}
+
+func (r *regardingRecorder) Eventf(regarding runtime.Object, related runtime.Object, eventtype, reason, action, note string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.regarding == nil {
+		r.regarding = map[string][]metav1.Object{}
+	}
+	r.regarding[reason] = append(r.regarding[reason], regarding.(metav1.Object))
+}
+
+// withHashes adds the source and spec hash annotations to the expected
+// annotations.
+func withHashes(keys Keys) Keys {
+	keys["policy-agent.cloudfoundry.org/source-hash"] = HaveLen(64)
+	keys["policy-agent.cloudfoundry.org/spec-hash"] = HaveLen(64)
+	return keys
+}
+
 var _ = Describe("Reconciler", func() {
 	var (
 		logger     lager.Logger
 		config     *agentconfig.Config
 		fakeClient ctrlclient.Client
+		recorder   *events.FakeRecorder
+		workloads  reconciler.Workloads
 	)
 
 	BeforeEach(func() {
@@ -41,22 +127,29 @@ var _ = Describe("Reconciler", func() {
 		logger.RegisterSink(lager.NewWriterSink(io.Discard, lager.DEBUG))
 
 		config = &agentconfig.Config{
-			Namespace: "default",
+			Namespace:          "default",
+			WorkloadNamespaces: []string{"default"},
 		}
 
-		fakeClient = fake.NewFakeClient()
+		workloads = reconciler.NewWorkloads([]corev1.Pod{
+			appPod("default", "space-guid-1", "app-guid-1"),
+			appPod("default", "space-guid-1", "app-guid-3"),
+		})
+
+		fakeClient = newFakeClient()
+		recorder = events.NewFakeRecorder(100)
 	})
 
 	Describe("New", func() {
 		It("creates a Reconciler instance", func() {
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 			Expect(reconciler).NotTo(BeNil())
 		})
 	})
 
 	Describe("Reconcile", func() {
 		It("removes obsolete security groups and C2C policies", func() {
-			fakeClient = fake.NewFakeClient(
+			fakeClient = newFakeClient(
 				&ciliumv2.CiliumNetworkPolicy{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "old-asg",
@@ -78,17 +171,42 @@ var _ = Describe("Reconciler", func() {
 					},
 				},
 			)
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 
-			Expect(reconciler.Reconcile(nil, nil)).To(BeNil())
+			Expect(reconciler.Reconcile(nil, nil, workloads)).To(BeNil())
 
 			policies := ciliumv2.CiliumNetworkPolicyList{}
 			Expect(fakeClient.List(context.Background(), &policies, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
 			Expect(policies.Items).To(HaveLen(0))
 		})
 
+		It("treats obsolete policies the cache still lists after their deletion as deleted", func() {
+			fakeClient = fake.NewClientBuilder().
+				WithObjects(&ciliumv2.CiliumNetworkPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "old-asg",
+						Namespace: config.Namespace,
+						Labels:    map[string]string{"app": "policy-agent"},
+					},
+				}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Delete: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.DeleteOption) error {
+						return apierrors.NewNotFound(ciliumv2.Resource("ciliumnetworkpolicies"), obj.GetName())
+					},
+				}).
+				Build()
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(nil, nil, workloads)).To(Succeed())
+
+			configMap := &corev1.ConfigMap{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: reconciler.StatusConfigMapName, Namespace: config.Namespace}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("deleted", "1"))
+			Expect(configMap.Data).To(HaveKeyWithValue("failed", "0"))
+		})
+
 		It("should raise error for noop policy", func() {
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 
 			Expect(reconciler.Reconcile([]policy.SecurityGroup{
 				{
@@ -101,11 +219,88 @@ var _ = Describe("Reconciler", func() {
 							Ports:       "80,443",
 						},
 					},
-				}}, []*policy.Policy{})).To(MatchError(ContainSubstring("no specs")))
+				}}, []*policy.Policy{}, workloads)).To(MatchError(ContainSubstring("no specs")))
+		})
+
+		It("keeps reconciling other policies when one ASG cannot be translated", func() {
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
+
+			err := reconciler.Reconcile([]policy.SecurityGroup{
+				{
+					Guid: "unbound",
+					Name: "unbound",
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+					},
+				},
+				{
+					Guid:           "tcp",
+					Name:           "tcp",
+					RunningDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "2.2.2.2/32", Protocol: "tcp", Ports: "443"},
+					},
+				},
+			}, []*policy.Policy{{
+				Source:      policy.Source{ID: "app-guid-1"},
+				Destination: policy.Destination{ID: "app-guid-2", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+			}}, workloads)
+			Expect(err).To(MatchError(`not able to translate ASG "unbound": no specs created`))
+
+			policies := ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
+			Expect(policies.Items).To(ConsistOf(
+				HaveField("Name", "tcp"),
+				HaveField("Name", "c2c-app-guid-1"),
+			))
+		})
+
+		It("aggregates the errors of all failed policies", func() {
+			fakeClient = fake.NewClientBuilder().
+				WithObjects(
+					&ciliumv2.CiliumNetworkPolicy{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "old-asg",
+							Namespace: config.Namespace,
+							Labels:    map[string]string{"app": "policy-agent"},
+						},
+					},
+				).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+						if obj.(metav1.Object).GetName() == "broken" {
+							return errors.New("create failed")
+						}
+						return applyUnlessDryRun(ctx, c, obj, opts...)
+					},
+					Delete: func(ctx context.Context, c ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.DeleteOption) error {
+						return errors.New("delete failed")
+					},
+				}).
+				Build()
+			var logBuffer bytes.Buffer
+			logger.RegisterSink(lager.NewWriterSink(&logBuffer, lager.DEBUG))
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			rules := []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}}
+			err := r.Reconcile([]policy.SecurityGroup{
+				{Guid: "broken", Name: "broken", RunningDefault: true, Rules: rules},
+				{Guid: "healthy", Name: "healthy", RunningDefault: true, Rules: rules},
+			}, nil, workloads)
+			Expect(err).To(MatchError(ContainSubstring(`not able to delete CiliumNetworkPolicy "old-asg" in namespace "default": delete failed`)))
+			Expect(err).To(MatchError(ContainSubstring(`not able to apply CiliumNetworkPolicy "broken" in namespace "default": create failed`)))
+			Expect(err).To(MatchError(reconciler.ErrPolicyFailed))
+
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "healthy", Namespace: config.Namespace}, &ciliumv2.CiliumNetworkPolicy{})).To(Succeed())
+
+			logs := logBuffer.String()
+			Expect(logs).To(MatchRegexp(`"message":"[^"]*applying policy diff".*"create":2,"delete":1,"unchanged":0,"update":0`))
+			Expect(logs).To(MatchRegexp(`"message":"[^"]*failed to create policy".*"namespace":"default".*"policy_name":"broken"`))
+			Expect(logs).To(MatchRegexp(`"message":"[^"]*created policy".*"namespace":"default".*"policy_name":"healthy"`))
 		})
 
 		It("creates new security groups and C2C policies", func() {
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 			Expect(reconciler.Reconcile([]policy.SecurityGroup{
 				{
 					Guid: "tcp",
@@ -171,7 +366,7 @@ var _ = Describe("Reconciler", func() {
 						Ports:    policy.Ports{Start: 5353, End: 5353},
 					},
 				},
-			})).To(BeNil())
+			}, workloads)).To(BeNil())
 
 			policies := ciliumv2.CiliumNetworkPolicyList{}
 			Expect(fakeClient.List(context.Background(), &policies, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
@@ -293,9 +488,9 @@ var _ = Describe("Reconciler", func() {
 					},
 				},
 			}
-			fakeClient = fake.NewFakeClient(asgPolicy, c2cPolicy)
+			fakeClient = newFakeClient(asgPolicy, c2cPolicy)
 
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 			Expect(reconciler.Reconcile([]policy.SecurityGroup{
 				{
 					Guid:           "tcp",
@@ -318,7 +513,7 @@ var _ = Describe("Reconciler", func() {
 						Ports:    policy.Ports{Start: 8080, End: 8080},
 					},
 				},
-			})).To(Succeed())
+			}, workloads)).To(Succeed())
 
 			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKeyFromObject(asgPolicy), asgPolicy)).To(Succeed())
 			Expect(asgPolicy.ObjectMeta.Name).To(Equal("tcp"))
@@ -411,16 +606,188 @@ var _ = Describe("Reconciler", func() {
 			var logBuffer bytes.Buffer
 			logger.RegisterSink(lager.NewWriterSink(&logBuffer, lager.DEBUG))
 
-			fakeClient = fake.NewFakeClient(ciliumPolicy)
-			reconciler := reconciler.New(fakeClient, config, logger)
-			Expect(reconciler.Reconcile(asg, []*policy.Policy{})).To(Succeed())
+			fakeClient = newFakeClient(ciliumPolicy)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(reconciler.Reconcile(asg, []*policy.Policy{}, workloads)).To(Succeed())
 
 			logs := logBuffer.String()
 			Expect(logs).To(ContainSubstring("unchanged"))
 		})
 
+		It("counts created, unchanged and deleted CiliumNetworkPolicies", func() {
+			operations := func(operation string) float64 {
+				return testutil.ToFloat64(metrics.NetworkPolicyOperations.WithLabelValues(operation))
+			}
+			created, unchanged, deleted := operations(metrics.OperationCreated), operations(metrics.OperationUnchanged), operations(metrics.OperationDeleted)
+
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "tcp",
+					Name:           "tcp",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+					},
+				},
+			}
+
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(reconciler.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(reconciler.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(reconciler.Reconcile(nil, nil, workloads)).To(Succeed())
+
+			Expect(operations(metrics.OperationCreated)).To(Equal(created + 1))
+			Expect(operations(metrics.OperationUnchanged)).To(Equal(unchanged + 1))
+			Expect(operations(metrics.OperationDeleted)).To(Equal(deleted + 1))
+		})
+
+		It("annotates CiliumNetworkPolicies with translation diagnostics", func() {
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "mixed",
+					Name:           "mixed",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32,1.1.1.5-1.1.1.2", Protocol: "tcp", Ports: "80"},
+						{Destination: "2.2.2.2/32", Protocol: "foo"},
+					},
+				},
+			}
+
+			logger = lager.NewLogger("reconciler-test")
+			var logBuffer bytes.Buffer
+			logger.RegisterSink(lager.NewWriterSink(&logBuffer, lager.DEBUG))
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "mixed", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Annotations).To(MatchAllKeys(withHashes(Keys{
+				"policy-agent.cloudfoundry.org/translation-warnings": Equal("1"),
+				"policy-agent.cloudfoundry.org/translation-errors":   Equal("1"),
+			})))
+			Expect(testutil.ToFloat64(metrics.TranslationDiagnostics.WithLabelValues(reconciler.FieldProtocol, string(reconciler.SeverityError)))).To(Equal(1.0))
+
+			Expect(r.Reconcile(nil, nil, workloads)).To(Succeed())
+			Expect(testutil.CollectAndCount(metrics.TranslationDiagnostics)).To(BeZero())
+
+			logs := logBuffer.String()
+			Expect(logs).To(ContainSubstring(`"asg_guid":"mixed"`))
+			Expect(logs).To(ContainSubstring(`"reason":"unsupported protocol"`))
+		})
+
+		It("removes translation annotations once the ASG translates cleanly", func() {
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "fixed",
+					Name:           "fixed",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "2.2.2.2/32", Protocol: "foo"},
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+					},
+				},
+			}
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			asgs[0].Rules = asgs[0].Rules[1:]
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "fixed", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Annotations).To(MatchAllKeys(withHashes(Keys{})))
+		})
+
+		It("annotates CiliumNetworkPolicies with the descriptions of translated ASG rules", func() {
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "described",
+					Name:           "described",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80", Description: "web servers"},
+						{Destination: "2.2.2.2/32", Protocol: "tcp", Ports: "443"},
+						{Destination: "3.3.3.3/32", Protocol: "foo", Description: "unsupported"},
+					},
+				},
+			}
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "described", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Annotations).To(MatchAllKeys(withHashes(Keys{
+				"policy-agent.cloudfoundry.org/rule-0-description":   Equal("web servers"),
+				"policy-agent.cloudfoundry.org/translation-warnings": Equal("0"),
+				"policy-agent.cloudfoundry.org/translation-errors":   Equal("1"),
+			})))
+
+			asgs[0].Rules[0].Description = "web proxies"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "described", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/rule-0-description", "web proxies"))
+		})
+
+		It("moves logged ASG rules into a separate spec marked for Hubble", func() {
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "logged",
+					Name:           "a-very-long-security-group-name-for-logging",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+						{Destination: "2.2.2.2/32", Protocol: "tcp", Ports: "443", Log: true},
+					},
+				},
+			}
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "logged", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Specs).To(HaveLen(2))
+			Expect(cnp.Specs[0].Log.Value).To(BeEmpty())
+			Expect(cnp.Specs[0].Egress).To(HaveLen(1))
+			Expect(cnp.Specs[0].Egress[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("1.1.1.1/32")))
+			Expect(cnp.Specs[1].Log.Value).To(Equal("a-very-long-security-group-name-"))
+			Expect(cnp.Specs[1].Description).To(Equal("logged rules of ASG a-very-long-security-group-name-for-logging"))
+			Expect(cnp.Specs[1].Egress).To(HaveLen(1))
+			Expect(cnp.Specs[1].Egress[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("2.2.2.2/32")))
+			Expect(cnp.Specs[1].EndpointSelector).To(Equal(cnp.Specs[0].EndpointSelector))
+		})
+
+		It("renders only the logged spec for an ASG whose rules are all logged", func() {
+			asgs := []policy.SecurityGroup{
+				{
+					Guid:           "all-logged",
+					Name:           "all-logged",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80", Log: true},
+						{Destination: "2.2.2.2/32", Protocol: "tcp", Ports: "443", Log: true},
+					},
+				},
+			}
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "all-logged", Namespace: config.Namespace}, cnp)).To(Succeed())
+			Expect(cnp.Specs).To(HaveLen(1))
+			Expect(cnp.Specs[0].Log.Value).To(Equal("all-logged"))
+			Expect(cnp.Specs[0].Egress).To(HaveLen(2))
+		})
+
 		It("aggregates multiple C2C policies for the same source and destination", func() {
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 
 			policies := []*policy.Policy{
 				{
@@ -441,7 +808,7 @@ var _ = Describe("Reconciler", func() {
 				},
 			}
 
-			Expect(reconciler.Reconcile(nil, policies)).To(Succeed())
+			Expect(reconciler.Reconcile(nil, policies, workloads)).To(Succeed())
 
 			cnpList := ciliumv2.CiliumNetworkPolicyList{}
 			Expect(fakeClient.List(context.Background(), &cnpList, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
@@ -454,7 +821,7 @@ var _ = Describe("Reconciler", func() {
 		})
 
 		It("creates separate egress rules for different C2C destinations", func() {
-			reconciler := reconciler.New(fakeClient, config, logger)
+			reconciler := reconciler.New(fakeClient, recorder, config, logger)
 
 			policies := []*policy.Policy{
 				{
@@ -475,7 +842,7 @@ var _ = Describe("Reconciler", func() {
 				},
 			}
 
-			Expect(reconciler.Reconcile(nil, policies)).To(Succeed())
+			Expect(reconciler.Reconcile(nil, policies, workloads)).To(Succeed())
 
 			cnpList := ciliumv2.CiliumNetworkPolicyList{}
 			Expect(fakeClient.List(context.Background(), &cnpList, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
@@ -486,4 +853,1001 @@ var _ = Describe("Reconciler", func() {
 			Expect(cnp.Specs[0].Egress).To(HaveLen(2))
 		})
 	})
+
+	Describe("workload namespaces", func() {
+		var (
+			r   reconciler.Reconciler
+			tcp []policy.SecurityGroupRule
+		)
+
+		BeforeEach(func() {
+			config.WorkloadNamespaces = []string{"cf-workloads-a", "cf-workloads-b"}
+			workloads = reconciler.NewWorkloads([]corev1.Pod{
+				appPod("cf-workloads-a", "space-guid-1", "app-guid-1"),
+				appPod("cf-workloads-b", "space-guid-2", "app-guid-2"),
+				appPod("unmanaged", "space-guid-3", "app-guid-3"),
+			})
+			tcp = []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}}
+			r = reconciler.New(fakeClient, recorder, config, logger)
+		})
+
+		policiesIn := func(namespace string) []ciliumv2.CiliumNetworkPolicy {
+			policies := ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies, ctrlclient.InNamespace(namespace))).To(Succeed())
+			return policies.Items
+		}
+
+		It("renders space-bound ASGs only into namespaces hosting their spaces", func() {
+			Expect(r.Reconcile([]policy.SecurityGroup{
+				{Guid: "global", Name: "global", RunningDefault: true, Rules: tcp},
+				{Guid: "space-1", Name: "space-1", RunningSpaceGuids: []string{"space-guid-1"}, Rules: tcp},
+				{Guid: "space-2", Name: "space-2", StagingSpaceGuids: []string{"space-guid-2"}, Rules: tcp},
+				{Guid: "space-3", Name: "space-3", RunningSpaceGuids: []string{"space-guid-3"}, Rules: tcp},
+			}, nil, workloads)).To(Succeed())
+
+			Expect(policiesIn("cf-workloads-a")).To(ConsistOf(HaveField("Name", "global"), HaveField("Name", "space-1")))
+			Expect(policiesIn("cf-workloads-b")).To(ConsistOf(HaveField("Name", "global"), HaveField("Name", "space-2")))
+			Expect(policiesIn("unmanaged")).To(BeEmpty())
+		})
+
+		It("renders C2C policies into the namespaces of the source and selects destinations in every workload namespace", func() {
+			Expect(r.Reconcile(nil, []*policy.Policy{{
+				Source:      policy.Source{ID: "app-guid-1"},
+				Destination: policy.Destination{ID: "app-guid-2", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+			}}, workloads)).To(Succeed())
+
+			Expect(policiesIn("cf-workloads-b")).To(BeEmpty())
+			policies := policiesIn("cf-workloads-a")
+			Expect(policies).To(ConsistOf(HaveField("Name", "c2c-app-guid-1")))
+			Expect(policies[0].Specs[0].Egress[0].ToEndpoints[0].LabelSelector.MatchExpressions).To(ConsistOf(slimv1.LabelSelectorRequirement{
+				Key:      "k8s:io.kubernetes.pod.namespace",
+				Operator: slimv1.LabelSelectorOpIn,
+				Values:   []string{"cf-workloads-a", "cf-workloads-b"},
+			}))
+		})
+
+		It("removes policies from namespaces which no longer host matching pods", func() {
+			unmanaged := &ciliumv2.CiliumNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "space-1",
+					Namespace: "unmanaged",
+					Labels:    map[string]string{"app": "policy-agent"},
+				},
+			}
+			Expect(fakeClient.Create(context.Background(), unmanaged)).To(Succeed())
+
+			asgs := []policy.SecurityGroup{
+				{Guid: "space-1", Name: "space-1", RunningSpaceGuids: []string{"space-guid-1", "space-guid-2"}, Rules: tcp},
+			}
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(policiesIn("cf-workloads-a")).To(HaveLen(1))
+			Expect(policiesIn("cf-workloads-b")).To(HaveLen(1))
+
+			workloads = reconciler.NewWorkloads([]corev1.Pod{
+				appPod("cf-workloads-a", "space-guid-1", "app-guid-1"),
+			})
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(policiesIn("cf-workloads-a")).To(HaveLen(1))
+			Expect(policiesIn("cf-workloads-b")).To(BeEmpty())
+			Expect(policiesIn("unmanaged")).To(HaveLen(1))
+		})
+
+		It("keeps the policies of ASGs which fail to translate in every namespace", func() {
+			for _, namespace := range config.WorkloadNamespaces {
+				Expect(fakeClient.Create(context.Background(), &ciliumv2.CiliumNetworkPolicy{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "broken",
+						Namespace: namespace,
+						Labels:    map[string]string{"app": "policy-agent"},
+					},
+				})).To(Succeed())
+			}
+
+			Expect(r.Reconcile([]policy.SecurityGroup{{Guid: "broken", Name: "broken", Rules: tcp}}, nil, workloads)).To(MatchError(ContainSubstring("no specs")))
+			Expect(policiesIn("cf-workloads-a")).To(HaveLen(1))
+			Expect(policiesIn("cf-workloads-b")).To(HaveLen(1))
+		})
+	})
+
+	Describe("server-side apply", func() {
+		var asgs []policy.SecurityGroup
+
+		BeforeEach(func() {
+			asgs = []policy.SecurityGroup{{
+				Guid:           "applied",
+				Name:           "applied",
+				StagingDefault: true,
+				Rules:          []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80", Description: "web"}},
+			}}
+		})
+
+		getPolicy := func() *ciliumv2.CiliumNetworkPolicy {
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "applied", Namespace: config.Namespace}, cnp)).To(Succeed())
+			return cnp
+		}
+
+		It("applies policies as the policy-agent field manager with forced ownership", func() {
+			var applied []*ctrlclient.ApplyOptions
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					applyOptions := &ctrlclient.ApplyOptions{}
+					applied = append(applied, applyOptions.ApplyOptions(opts))
+					return applyUnlessDryRun(ctx, c, obj, opts...)
+				},
+			}).Build()
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(applied).To(HaveLen(1))
+			Expect(applied[0].FieldManager).To(Equal(reconciler.FieldManager))
+			Expect(applied[0].Force).To(HaveValue(BeTrue()))
+			Expect(applied[0].DryRun).To(BeEmpty())
+
+			asgs[0].Rules[0].Ports = "443"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(applied).To(HaveLen(3))
+			Expect(applied[1].FieldManager).To(Equal(reconciler.FieldManager))
+			Expect(applied[1].DryRun).To(ConsistOf(metav1.DryRunAll))
+			Expect(applied[2].DryRun).To(BeEmpty())
+		})
+
+		It("does not send requests for policies which match the cached ones", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			applies, gets, lists := 0, 0, 0
+			fakeClient = fake.NewClientBuilder().WithObjects(getPolicy()).WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					applies++
+					return applyUnlessDryRun(ctx, c, obj, opts...)
+				},
+				Get: func(ctx context.Context, c ctrlclient.WithWatch, key ctrlclient.ObjectKey, obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
+					gets++
+					return c.Get(ctx, key, obj, opts...)
+				},
+				List: func(ctx context.Context, c ctrlclient.WithWatch, list ctrlclient.ObjectList, opts ...ctrlclient.ListOption) error {
+					if _, ok := list.(*ciliumv2.CiliumNetworkPolicyList); ok {
+						lists++
+					}
+					return c.List(ctx, list, opts...)
+				},
+			}).Build()
+
+			var logBuffer bytes.Buffer
+			logger.RegisterSink(lager.NewWriterSink(&logBuffer, lager.DEBUG))
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(applies).To(BeZero())
+			Expect(lists).To(Equal(1))
+			Expect(gets).To(BeZero())
+			Expect(logBuffer.String()).To(ContainSubstring("policies up to date"))
+			Expect(logBuffer.String()).NotTo(ContainSubstring("applying policy diff"))
+		})
+
+		It("does not write policies whose dry run matches the existing ones", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			// another field manager annotates the policy under the agent's
+			// prefix, which a dry run keeps as the agent does not own it
+			cnp := getPolicy()
+			cnp.Annotations["policy-agent.cloudfoundry.org/reviewed-by"] = "operator"
+			Expect(fakeClient.Update(context.Background(), cnp, ctrlclient.FieldOwner("operator"))).To(Succeed())
+
+			var applied []*ctrlclient.ApplyOptions
+			fakeClient = fake.NewClientBuilder().WithObjects(getPolicy()).WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					applyOptions := &ctrlclient.ApplyOptions{}
+					applied = append(applied, applyOptions.ApplyOptions(opts))
+					return applyUnlessDryRun(ctx, c, obj, opts...)
+				},
+			}).Build()
+			r = reconciler.New(fakeClient, recorder, config, logger)
+			updated := testutil.ToFloat64(metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationUpdated))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(applied).To(ConsistOf(HaveField("DryRun", ConsistOf(metav1.DryRunAll))))
+			Expect(getPolicy().Annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/reviewed-by", "operator"))
+			Expect(testutil.ToFloat64(metrics.NetworkPolicyOperations.WithLabelValues(metrics.OperationUpdated))).To(Equal(updated))
+		})
+
+		It("does not write policies if the managed policies cannot be listed", func() {
+			applies := 0
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					applies++
+					return applyUnlessDryRun(ctx, c, obj, opts...)
+				},
+				List: func(ctx context.Context, c ctrlclient.WithWatch, list ctrlclient.ObjectList, opts ...ctrlclient.ListOption) error {
+					if _, ok := list.(*ciliumv2.CiliumNetworkPolicyList); ok {
+						return errors.New("cache not synced")
+					}
+					return c.List(ctx, list, opts...)
+				},
+			}).Build()
+
+			err := reconciler.New(fakeClient, recorder, config, logger).Reconcile(asgs, nil, workloads)
+			Expect(err).To(MatchError(ContainSubstring("cache not synced")))
+			Expect(err).NotTo(MatchError(reconciler.ErrPolicyFailed))
+			Expect(applies).To(BeZero())
+		})
+
+		It("writes no more policies in parallel than the write concurrency", func() {
+			var inFlight, maxInFlight atomic.Int32
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					current := inFlight.Add(1)
+					defer inFlight.Add(-1)
+					for {
+						highest := maxInFlight.Load()
+						if current <= highest || maxInFlight.CompareAndSwap(highest, current) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					return applyUnlessDryRun(ctx, c, obj, opts...)
+				},
+			}).Build()
+			config.WriteConcurrency = 3
+
+			asgs = nil
+			for i := range 10 {
+				asgs = append(asgs, policy.SecurityGroup{
+					Guid:           fmt.Sprintf("asg-%d", i),
+					Name:           fmt.Sprintf("asg-%d", i),
+					StagingDefault: true,
+					Rules:          []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}},
+				})
+			}
+
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			list := &ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), list)).To(Succeed())
+			Expect(list.Items).To(HaveLen(10))
+			Expect(maxInFlight.Load()).To(BeNumerically(">", 1))
+			Expect(maxInFlight.Load()).To(BeNumerically("<=", 3))
+		})
+
+		It("keeps labels and annotations added by others", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := getPolicy()
+			cnp.Labels["team"] = "networking"
+			cnp.Annotations["example.com/owner"] = "networking"
+			Expect(fakeClient.Update(context.Background(), cnp)).To(Succeed())
+
+			asgs[0].Rules[0].Ports = "443"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp = getPolicy()
+			Expect(cnp.Specs[0].Egress[0].ToPorts[0].Ports[0].Port).To(Equal("443"))
+			Expect(cnp.Labels).To(HaveKeyWithValue("team", "networking"))
+			Expect(cnp.Annotations).To(HaveKeyWithValue("example.com/owner", "networking"))
+		})
+
+		It("converges drift of the rendered annotations", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := getPolicy()
+			cnp.Annotations["policy-agent.cloudfoundry.org/rule-0-description"] = "changed"
+			Expect(fakeClient.Update(context.Background(), cnp)).To(Succeed())
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(getPolicy().Annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/rule-0-description", "web"))
+		})
+	})
+
+	Describe("drift", func() {
+		var asgs []policy.SecurityGroup
+
+		BeforeEach(func() {
+			asgs = []policy.SecurityGroup{{
+				Guid:              "drifting",
+				Name:              "drifting",
+				RunningSpaceGuids: []string{"space-guid-1", "space-guid-2"},
+				Rules:             []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}},
+			}}
+		})
+
+		getPolicy := func() *ciliumv2.CiliumNetworkPolicy {
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "drifting", Namespace: config.Namespace}, cnp)).To(Succeed())
+			return cnp
+		}
+
+		editPorts := func() {
+			cnp := getPolicy()
+			cnp.Specs[0].Egress[0].ToPorts[0].Ports[0].Port = "8080"
+			Expect(fakeClient.Update(context.Background(), cnp)).To(Succeed())
+		}
+
+		drainEvents := func() {
+			for len(recorder.Events) > 0 {
+				<-recorder.Events
+			}
+		}
+
+		It("hashes the source and the rendered specs independent of the order of space bindings", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			annotations := getPolicy().Annotations
+			Expect(annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/source-hash", HaveLen(64)))
+			Expect(annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/spec-hash", HaveLen(64)))
+
+			slices.Reverse(asgs[0].RunningSpaceGuids)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(getPolicy().Annotations).To(Equal(annotations))
+
+			asgs[0].RunningSpaceGuids = append(asgs[0].RunningSpaceGuids, "space-guid-3")
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(getPolicy().Annotations).NotTo(HaveKeyWithValue("policy-agent.cloudfoundry.org/source-hash", annotations["policy-agent.cloudfoundry.org/source-hash"]))
+			Expect(getPolicy().Annotations).NotTo(HaveKeyWithValue("policy-agent.cloudfoundry.org/spec-hash", annotations["policy-agent.cloudfoundry.org/spec-hash"]))
+		})
+
+		It("reverts edited specs by default", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			drainEvents()
+
+			editPorts()
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			Expect(getPolicy().Specs[0].Egress[0].ToPorts[0].Ports[0].Port).To(Equal("80"))
+			Expect(recorder.Events).To(Receive(Equal("Normal Updated updated CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(Equal("Warning DriftReverted reverted edited specs of CiliumNetworkPolicy")))
+		})
+
+		It("only reports edited specs if the drift policy says so", func() {
+			config.DriftPolicy = agentconfig.DriftPolicyReport
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			drainEvents()
+
+			editPorts()
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			Expect(getPolicy().Specs[0].Egress[0].ToPorts[0].Ports[0].Port).To(Equal("8080"))
+			Expect(recorder.Events).To(Receive(Equal("Warning DriftDetected specs of CiliumNetworkPolicy were edited and differ from the rendered ones")))
+
+			configMap := &corev1.ConfigMap{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: reconciler.StatusConfigMapName, Namespace: config.Namespace}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("drifted", "1"))
+			Expect(configMap.Data).To(HaveKeyWithValue("updated", "0"))
+		})
+
+		It("updates edited policies whose source changed even if drift is only reported", func() {
+			config.DriftPolicy = agentconfig.DriftPolicyReport
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			editPorts()
+			asgs[0].Rules[0].Ports = "443"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			Expect(getPolicy().Specs[0].Egress[0].ToPorts[0].Ports[0].Port).To(Equal("443"))
+		})
+	})
+
+	Describe("NewDiff", func() {
+		managedPolicy := func(name, ruleName string) *ciliumv2.CiliumNetworkPolicy {
+			return &ciliumv2.CiliumNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+					Labels:    map[string]string{"app": "policy-agent", "rule-name": ruleName},
+				},
+			}
+		}
+
+		It("sorts desired and actual policies into creates, updates, deletes and unchanged ones", func() {
+			unchanged := managedPolicy("unchanged", "unchanged")
+			outdated := managedPolicy("updated", "outdated")
+			updated := managedPolicy("updated", "updated")
+			created := managedPolicy("created", "created")
+			obsolete := managedPolicy("obsolete", "obsolete")
+			retained := managedPolicy("retained", "retained")
+			clusterwide := &ciliumv2.CiliumClusterwideNetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "unchanged"}}
+
+			diff := reconciler.NewDiff(
+				[]ctrlclient.Object{unchanged.DeepCopy(), updated, created},
+				[]ctrlclient.Object{unchanged, outdated, obsolete, retained, clusterwide},
+				map[string]struct{}{"retained": {}},
+				nil,
+			)
+
+			Expect(diff.Create).To(ConsistOf(created))
+			Expect(diff.Update).To(ConsistOf(reconciler.PolicyUpdate{Existing: outdated, Desired: updated}))
+			Expect(diff.Delete).To(ConsistOf(obsolete, clusterwide))
+			Expect(diff.Unchanged).To(HaveLen(1))
+			Expect(diff.Changed()).To(BeTrue())
+		})
+
+		It("reports no change if all desired policies exist unchanged", func() {
+			policy := managedPolicy("unchanged", "unchanged")
+			diff := reconciler.NewDiff([]ctrlclient.Object{policy.DeepCopy()}, []ctrlclient.Object{policy}, nil, nil)
+
+			Expect(diff.Changed()).To(BeFalse())
+			Expect(diff.Unchanged).To(HaveLen(1))
+		})
+
+		It("hashes the specs of an existing policy once per resource version", func() {
+			desired := managedPolicy("policy", "policy")
+			desired.Specs = ciliumapi.Rules{{Description: "rendered"}}
+			data, err := json.Marshal(desired.Specs)
+			Expect(err).NotTo(HaveOccurred())
+			sum := sha256.Sum256(data)
+			desired.Annotations = map[string]string{
+				"policy-agent.cloudfoundry.org/source-hash": "source",
+				"policy-agent.cloudfoundry.org/spec-hash":   hex.EncodeToString(sum[:]),
+			}
+			existing := desired.DeepCopy()
+			existing.UID = "uid"
+			existing.ResourceVersion = "1"
+			hashes := reconciler.NewSpecHashCache()
+			diff := func() reconciler.Diff {
+				return reconciler.NewDiff([]ctrlclient.Object{desired}, []ctrlclient.Object{existing}, nil, hashes)
+			}
+			Expect(diff().Unchanged).To(HaveLen(1))
+
+			// edits always come with a new resource version, so the cached
+			// hash is reused as long as the resource version is unchanged
+			existing.Specs[0].Description = "edited"
+			Expect(diff().Unchanged).To(HaveLen(1))
+
+			existing.ResourceVersion = "2"
+			Expect(diff().Update).To(ConsistOf(HaveField("Drifted", BeTrue())))
+		})
+	})
+
+	Describe("ASG names", func() {
+		getPolicy := func(name string) *ciliumv2.CiliumNetworkPolicy {
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: name, Namespace: config.Namespace}, cnp)).To(Succeed())
+			return cnp
+		}
+
+		It("sanitises names which are no valid label values and keeps them in an annotation", func() {
+			name := "Platform / DNS servers " + strings.Repeat("x", 60)
+			asgs := []policy.SecurityGroup{
+				{Guid: "invalid", Name: name, StagingDefault: true, Rules: []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "53"}}},
+				{Guid: "valid", Name: "dns_servers.v2", StagingDefault: true, Rules: []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "53"}}},
+			}
+
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := getPolicy("invalid")
+			Expect(cnp.Labels).To(HaveKeyWithValue("rule-name", reconciler.SanitizeLabelValue(name)))
+			Expect(cnp.Annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/rule-name", name))
+
+			cnp = getPolicy("valid")
+			Expect(cnp.Labels).To(HaveKeyWithValue("rule-name", "dns_servers.v2"))
+			Expect(cnp.Annotations).To(MatchAllKeys(withHashes(Keys{})))
+		})
+
+		It("relabels existing policies whose rule-name label is outdated", func() {
+			rules := []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "53"}}
+			asgs := []policy.SecurityGroup{{Guid: "renamed", Name: "dns", StagingDefault: true, Rules: rules}}
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := getPolicy("renamed")
+			cnp.Labels["rule-name"] = "outdated"
+			Expect(fakeClient.Update(context.Background(), cnp)).To(Succeed())
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(getPolicy("renamed").Labels).To(HaveKeyWithValue("rule-name", "dns"))
+
+			asgs[0].Name = "internal dns"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp = getPolicy("renamed")
+			Expect(cnp.Labels).To(HaveKeyWithValue("rule-name", reconciler.SanitizeLabelValue("internal dns")))
+			Expect(cnp.Annotations).To(HaveKeyWithValue("policy-agent.cloudfoundry.org/rule-name", "internal dns"))
+		})
+
+		DescribeTable("SanitizeLabelValue", func(name string, matcher types.GomegaMatcher) {
+			value := reconciler.SanitizeLabelValue(name)
+			Expect(value).To(matcher)
+			Expect(validation.IsValidLabelValue(value)).To(BeEmpty())
+			Expect(reconciler.SanitizeLabelValue(name)).To(Equal(value))
+		},
+			Entry("a valid name", "public_networks-1.0", Equal("public_networks-1.0")),
+			Entry("an empty name", "", Equal("")),
+			Entry("spaces and slashes", "a b/c", MatchRegexp(`^a-b-c-[0-9a-f]{8}$`)),
+			Entry("invalid leading and trailing characters", " -dns- ", MatchRegexp(`^dns-[0-9a-f]{8}$`)),
+			Entry("non-ASCII characters", "Zürich", MatchRegexp(`^Z-rich-[0-9a-f]{8}$`)),
+			Entry("only invalid characters", "***", MatchRegexp(`^[0-9a-f]{8}$`)),
+			Entry("a long name", strings.Repeat("a", 64), MatchRegexp(`^a{54}-[0-9a-f]{8}$`)),
+		)
+
+		It("keeps sanitised names apart", func() {
+			Expect(reconciler.SanitizeLabelValue("a b")).NotTo(Equal(reconciler.SanitizeLabelValue("a/b")))
+			Expect(reconciler.SanitizeLabelValue(strings.Repeat("a", 64) + "1")).NotTo(Equal(reconciler.SanitizeLabelValue(strings.Repeat("a", 64) + "2")))
+		})
+	})
+
+	Describe("C2C enforcement", func() {
+		var policies []*policy.Policy
+
+		BeforeEach(func() {
+			config.WorkloadNamespaces = []string{"cf-workloads-a", "cf-workloads-b"}
+			workloads = reconciler.NewWorkloads([]corev1.Pod{
+				appPod("cf-workloads-a", "space-guid-1", "app-guid-1"),
+				appPod("cf-workloads-a", "space-guid-1", "app-guid-2"),
+				appPod("cf-workloads-b", "space-guid-2", "app-guid-3"),
+			})
+			policies = []*policy.Policy{
+				{
+					Source:      policy.Source{ID: "app-guid-2"},
+					Destination: policy.Destination{ID: "app-guid-3", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+				},
+				{
+					Source:      policy.Source{ID: "app-guid-1"},
+					Destination: policy.Destination{ID: "app-guid-3", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+				},
+				{
+					Source:      policy.Source{ID: "app-guid-1"},
+					Destination: policy.Destination{ID: "app-guid-3", Protocol: "udp", Ports: policy.Ports{Start: 9000, End: 9010}},
+				},
+			}
+		})
+
+		policyNames := func() []string {
+			policies := ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies)).To(Succeed())
+			var names []string
+			for _, cnp := range policies.Items {
+				names = append(names, cnp.Namespace+"/"+cnp.Name)
+			}
+			return names
+		}
+
+		It("only renders egress policies of the source apps by default", func() {
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies, workloads)).To(Succeed())
+
+			Expect(policyNames()).To(ConsistOf("cf-workloads-a/c2c-app-guid-1", "cf-workloads-a/c2c-app-guid-2"))
+		})
+
+		It("renders ingress policies of the destination apps allowing every source app", func() {
+			config.C2CEnforcement = agentconfig.C2CEnforcementIngress
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies, workloads)).To(Succeed())
+
+			Expect(policyNames()).To(ConsistOf("cf-workloads-b/c2c-ingress-app-guid-3"))
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "c2c-ingress-app-guid-3", Namespace: "cf-workloads-b"}, cnp)).To(Succeed())
+			Expect(cnp.Labels).To(HaveKeyWithValue("app", "policy-agent"))
+			Expect(cnp.Specs).To(HaveLen(1))
+			Expect(cnp.Specs[0].EndpointSelector.LabelSelector.MatchLabels).To(Equal(map[string]string{"cloudfoundry.org/app-guid": "app-guid-3"}))
+			Expect(cnp.Specs[0].Egress).To(BeEmpty())
+			Expect(cnp.Specs[0].EnableDefaultDeny.Ingress).To(HaveValue(BeFalse()))
+			Expect(cnp.Specs[0].EnableDefaultDeny.Egress).To(BeNil())
+			Expect(cnp.Specs[0].Ingress).To(Equal([]ciliumapi.IngressRule{
+				{
+					IngressCommonRule: ciliumapi.IngressCommonRule{
+						FromEndpoints: []ciliumapi.EndpointSelector{{LabelSelector: &slimv1.LabelSelector{
+							MatchLabels: map[string]string{"cloudfoundry.org/app-guid": "app-guid-1"},
+							MatchExpressions: []slimv1.LabelSelectorRequirement{{
+								Key:      "k8s:io.kubernetes.pod.namespace",
+								Operator: slimv1.LabelSelectorOpIn,
+								Values:   []string{"cf-workloads-a", "cf-workloads-b"},
+							}},
+						}}},
+					},
+					ToPorts: ciliumapi.PortRules{{Ports: []ciliumapi.PortProtocol{
+						{Port: "8080", EndPort: 8080, Protocol: ciliumapi.ProtoTCP},
+						{Port: "9000", EndPort: 9010, Protocol: ciliumapi.ProtoUDP},
+					}}},
+				},
+				{
+					IngressCommonRule: ciliumapi.IngressCommonRule{
+						FromEndpoints: []ciliumapi.EndpointSelector{{LabelSelector: &slimv1.LabelSelector{
+							MatchLabels: map[string]string{"cloudfoundry.org/app-guid": "app-guid-2"},
+							MatchExpressions: []slimv1.LabelSelectorRequirement{{
+								Key:      "k8s:io.kubernetes.pod.namespace",
+								Operator: slimv1.LabelSelectorOpIn,
+								Values:   []string{"cf-workloads-a", "cf-workloads-b"},
+							}},
+						}}},
+					},
+					ToPorts: ciliumapi.PortRules{{Ports: []ciliumapi.PortProtocol{
+						{Port: "8080", EndPort: 8080, Protocol: ciliumapi.ProtoTCP},
+					}}},
+				},
+			}))
+		})
+
+		It("renders egress and ingress policies in both mode", func() {
+			config.C2CEnforcement = agentconfig.C2CEnforcementBoth
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies, workloads)).To(Succeed())
+
+			Expect(policyNames()).To(ConsistOf(
+				"cf-workloads-a/c2c-app-guid-1",
+				"cf-workloads-a/c2c-app-guid-2",
+				"cf-workloads-b/c2c-ingress-app-guid-3",
+			))
+		})
+
+		It("removes the policies of a side which is no longer enforced", func() {
+			config.C2CEnforcement = agentconfig.C2CEnforcementBoth
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies, workloads)).To(Succeed())
+
+			config.C2CEnforcement = agentconfig.C2CEnforcementIngress
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies, workloads)).To(Succeed())
+			Expect(policyNames()).To(ConsistOf("cf-workloads-b/c2c-ingress-app-guid-3"))
+
+			config.C2CEnforcement = agentconfig.C2CEnforcementEgress
+			Expect(reconciler.New(fakeClient, recorder, config, logger).Reconcile(nil, policies[:1], workloads)).To(Succeed())
+			Expect(policyNames()).To(ConsistOf("cf-workloads-a/c2c-app-guid-2"))
+		})
+	})
+
+	Describe("clusterwide global ASGs", func() {
+		var (
+			r    reconciler.Reconciler
+			asgs []policy.SecurityGroup
+		)
+
+		BeforeEach(func() {
+			config.ClusterwideGlobalASGs = true
+			config.WorkloadNamespaces = []string{"default", "cf-workloads-b"}
+			tcp := []policy.SecurityGroupRule{{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"}}
+			asgs = []policy.SecurityGroup{
+				{Guid: "global", Name: "global", RunningDefault: true, Rules: tcp},
+				{Guid: "space-1", Name: "space-1", RunningSpaceGuids: []string{"space-guid-1"}, Rules: tcp},
+			}
+			r = reconciler.New(fakeClient, recorder, config, logger)
+		})
+
+		clusterwidePolicies := func() []ciliumv2.CiliumClusterwideNetworkPolicy {
+			policies := ciliumv2.CiliumClusterwideNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies)).To(Succeed())
+			return policies.Items
+		}
+
+		It("renders global ASGs clusterwide and space-bound ASGs namespaced", func() {
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			policies := ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies)).To(Succeed())
+			Expect(policies.Items).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"ObjectMeta": MatchFields(IgnoreExtras, Fields{"Name": Equal("space-1"), "Namespace": Equal("default")}),
+			})))
+
+			ccnps := clusterwidePolicies()
+			Expect(ccnps).To(ConsistOf(HaveField("Name", "global")))
+			Expect(ccnps[0].Labels).To(HaveKeyWithValue("app", "policy-agent"))
+			Expect(ccnps[0].Specs).To(HaveLen(1))
+			Expect(ccnps[0].Specs[0].EndpointSelector.LabelSelector.MatchExpressions).To(ConsistOf(
+				slimv1.LabelSelectorRequirement{
+					Key:      "cloudfoundry.org/source-type",
+					Operator: slimv1.LabelSelectorOpNotIn,
+					Values:   []string{"STG"},
+				},
+				slimv1.LabelSelectorRequirement{
+					Key:      "k8s:io.kubernetes.pod.namespace",
+					Operator: slimv1.LabelSelectorOpIn,
+					Values:   []string{"default", "cf-workloads-b"},
+				},
+			))
+			Expect(recorder.Events).To(Receive(Equal("Normal Created created CiliumClusterwideNetworkPolicy")))
+		})
+
+		It("leaves unchanged CiliumClusterwideNetworkPolicies alone", func() {
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			resourceVersion := clusterwidePolicies()[0].ResourceVersion
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(clusterwidePolicies()[0].ResourceVersion).To(Equal(resourceVersion))
+		})
+
+		It("replaces namespaced policies of global ASGs and removes obsolete CiliumClusterwideNetworkPolicies", func() {
+			Expect(fakeClient.Create(context.Background(), &ciliumv2.CiliumNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "global",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "policy-agent"},
+				},
+			})).To(Succeed())
+			Expect(fakeClient.Create(context.Background(), &ciliumv2.CiliumClusterwideNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "old-global",
+					Labels: map[string]string{"app": "policy-agent"},
+				},
+			})).To(Succeed())
+			Expect(fakeClient.Create(context.Background(), &ciliumv2.CiliumClusterwideNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "unmanaged"},
+			})).To(Succeed())
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			err := fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "global", Namespace: "default"}, cnp)
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+			Expect(clusterwidePolicies()).To(ConsistOf(HaveField("Name", "global"), HaveField("Name", "unmanaged")))
+		})
+
+		It("deletes managed CiliumClusterwideNetworkPolicies once global ASGs are rendered namespaced again", func() {
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(clusterwidePolicies()).To(ConsistOf(HaveField("Name", "global")))
+
+			config.ClusterwideGlobalASGs = false
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			Expect(clusterwidePolicies()).To(BeEmpty())
+			cnp := &ciliumv2.CiliumNetworkPolicy{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: "global", Namespace: "default"}, cnp)).To(Succeed())
+		})
+	})
+
+	Describe("events and status", func() {
+		var asgs []policy.SecurityGroup
+
+		BeforeEach(func() {
+			asgs = []policy.SecurityGroup{
+				{
+					Guid:           "tcp",
+					Name:           "tcp",
+					StagingDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+					},
+				},
+			}
+		})
+
+		statusData := func() map[string]string {
+			configMap := &corev1.ConfigMap{}
+			Expect(fakeClient.Get(context.Background(), ctrlclient.ObjectKey{Name: reconciler.StatusConfigMapName, Namespace: config.Namespace}, configMap)).To(Succeed())
+			return configMap.Data
+		}
+
+		It("records events for created, updated and deleted CiliumNetworkPolicies", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(recorder.Events).To(Receive(Equal("Normal Created created CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(Equal("Normal Reconciled created 1, updated 0 and deleted 0 CiliumNetworkPolicies")))
+
+			asgs[0].Rules[0].Ports = "443"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(recorder.Events).To(Receive(Equal("Normal Updated updated CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(Equal("Normal Reconciled created 0, updated 1 and deleted 0 CiliumNetworkPolicies")))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(recorder.Events).NotTo(Receive())
+
+			Expect(r.Reconcile(nil, nil, workloads)).To(Succeed())
+			Expect(recorder.Events).To(Receive(Equal("Normal Deleted deleted obsolete CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(Equal("Normal Reconciled created 0, updated 0 and deleted 1 CiliumNetworkPolicies")))
+		})
+
+		It("records events against the policies returned by the API server", func() {
+			// the fake client does not assign UIDs like the API server does
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					if err := applyUnlessDryRun(ctx, c, obj, opts...); err != nil {
+						return err
+					}
+					obj.(metav1.Object).SetUID(ktypes.UID("uid-" + obj.(metav1.Object).GetName()))
+					return nil
+				},
+			}).Build()
+			asgs[0].Rules = append(asgs[0].Rules, policy.SecurityGroupRule{Destination: "2.2.2.2/32", Protocol: "foo"})
+			recorder := &regardingRecorder{}
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			asgs[0].Rules[0].Ports = "443"
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+
+			for _, reason := range []string{reconciler.ReasonCreated, reconciler.ReasonUpdated, reconciler.ReasonTranslationDiagnostics} {
+				Expect(recorder.regarding[reason]).NotTo(BeEmpty())
+				for _, regarding := range recorder.regarding[reason] {
+					Expect(regarding.GetUID()).To(Equal(ktypes.UID("uid-tcp")), reason)
+				}
+			}
+		})
+
+		It("records a warning event for ASGs with dropped rules", func() {
+			asgs[0].Rules = append(asgs[0].Rules, policy.SecurityGroupRule{Destination: "2.2.2.2/32", Protocol: "foo"})
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(recorder.Events).To(Receive(Equal("Normal Created created CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(Equal("Warning TranslationDiagnostics dropped 0 rule entries and 1 rules of the ASG during translation, see agent logs for details")))
+		})
+
+		It("writes a status ConfigMap summarising the last reconcile", func() {
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, []*policy.Policy{{
+				Source:      policy.Source{ID: "app-guid-1"},
+				Destination: policy.Destination{ID: "app-guid-2", Protocol: "tcp", Ports: policy.Ports{Start: 8080, End: 8080}},
+			}}, workloads)).To(Succeed())
+
+			Expect(statusData()).To(MatchKeys(IgnoreExtras, Keys{
+				"last-reconcile":  Not(BeEmpty()),
+				"result":          Equal("success"),
+				"security-groups": Equal("1"),
+				"c2c-policies":    Equal("1"),
+				"created":         Equal("2"),
+				"unchanged":       Equal("0"),
+			}))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(statusData()).To(MatchKeys(IgnoreExtras, Keys{
+				"c2c-policies": Equal("0"),
+				"created":      Equal("0"),
+				"deleted":      Equal("1"),
+				"unchanged":    Equal("1"),
+			}))
+		})
+
+		It("records a warning event and the error when writing a CiliumNetworkPolicy fails", func() {
+			fakeClient = fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Apply: func(ctx context.Context, c ctrlclient.WithWatch, obj runtime.ApplyConfiguration, opts ...ctrlclient.ApplyOption) error {
+					return errors.New("boom")
+				},
+			}).Build()
+
+			r := reconciler.New(fakeClient, recorder, config, logger)
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(`not able to apply CiliumNetworkPolicy "tcp" in namespace "default": boom`))
+			Expect(recorder.Events).To(Receive(Equal("Warning CreateFailed failed to create CiliumNetworkPolicy: boom")))
+			Expect(recorder.Events).To(Receive(Equal("Warning ReconcileFailed failed to reconcile 1 CiliumNetworkPolicies, see the status ConfigMap for details")))
+
+			Expect(statusData()).To(MatchKeys(IgnoreExtras, Keys{
+				"result": Equal("error"),
+				"failed": Equal("1"),
+				"error":  Equal(`not able to apply CiliumNetworkPolicy "tcp" in namespace "default": boom`),
+			}))
+		})
+	})
+
+	Describe("deletion guard", func() {
+		var (
+			managed []ctrlclient.Object
+			asgs    []policy.SecurityGroup
+		)
+
+		managedPolicy := func(name string, annotations map[string]string) *ciliumv2.CiliumNetworkPolicy {
+			return &ciliumv2.CiliumNetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   config.Namespace,
+					Labels:      map[string]string{"app": "policy-agent"},
+					Annotations: annotations,
+				},
+			}
+		}
+
+		policyNames := func() []string {
+			policies := ciliumv2.CiliumNetworkPolicyList{}
+			Expect(fakeClient.List(context.Background(), &policies, ctrlclient.InNamespace(config.Namespace))).To(Succeed())
+			names := []string{}
+			for _, p := range policies.Items {
+				names = append(names, p.Name)
+			}
+			return names
+		}
+
+		BeforeEach(func() {
+			config.DeletionGuardMaxPercent = 50
+			config.DeletionGuardPasses = 3
+
+			managed = []ctrlclient.Object{
+				managedPolicy("asg-1", nil),
+				managedPolicy("asg-2", nil),
+				managedPolicy("asg-3", nil),
+				managedPolicy("asg-4", nil),
+			}
+			asgs = []policy.SecurityGroup{
+				{
+					Guid:           "asg-1",
+					Name:           "asg-1",
+					RunningDefault: true,
+					Rules: []policy.SecurityGroupRule{
+						{Destination: "1.1.1.1/32", Protocol: "tcp", Ports: "80"},
+					},
+				},
+			}
+		})
+
+		It("withholds deletions above the threshold until they persist for consecutive passes", func() {
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(testutil.ToFloat64(metrics.WithheldDeletions)).To(Equal(3.0))
+			Expect(recorder.Events).To(Receive(Equal("Normal Updated updated CiliumNetworkPolicy")))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning DeletionsWithheld withheld deletion of 3 obsolete CiliumNetworkPolicies")))
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(policyNames()).To(HaveLen(4))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(policyNames()).To(ConsistOf("asg-1"))
+			Expect(testutil.ToFloat64(metrics.WithheldDeletions)).To(Equal(0.0))
+		})
+
+		It("restarts counting once the deletions fall below the threshold", func() {
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+
+			// the policy server recovered and still reports all but one ASG
+			recovered := []policy.SecurityGroup{asgs[0], asgs[0], asgs[0]}
+			recovered[1].Guid, recovered[2].Guid = "asg-2", "asg-3"
+			Expect(r.Reconcile(recovered, nil, workloads)).To(Succeed())
+			Expect(policyNames()).To(ConsistOf("asg-1", "asg-2", "asg-3"))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(policyNames()).To(HaveLen(3))
+		})
+
+		It("withholds deletions for the deletion guard window however quickly passes follow", func() {
+			config.PollInterval = 50 * time.Millisecond
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			for range 5 {
+				Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			}
+			Expect(policyNames()).To(HaveLen(4))
+
+			Eventually(func() error { return r.Reconcile(asgs, nil, workloads) }).Should(Succeed())
+			Expect(policyNames()).To(ConsistOf("asg-1"))
+		})
+
+		It("does not count passes reusing cached policy server data", func() {
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			for range 5 {
+				Expect(r.Reconcile(asgs, nil, workloads, reconciler.WithCachedData())).To(MatchError(reconciler.ErrDeletionsWithheld))
+			}
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(reconciler.ErrDeletionsWithheld))
+			Expect(policyNames()).To(HaveLen(4))
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(Succeed())
+			Expect(policyNames()).To(ConsistOf("asg-1"))
+		})
+
+		It("withholds deletions above the absolute threshold", func() {
+			config.DeletionGuardMaxPercent = 0
+			config.DeletionGuardMaxCount = 2
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(ContainSubstring("3 of 4 policies")))
+			Expect(policyNames()).To(HaveLen(4))
+		})
+
+		It("deletes policies annotated to allow their deletion", func() {
+			config.DeletionGuardMaxPercent = 20
+			managed[1] = managedPolicy("asg-2", map[string]string{"policy-agent.cloudfoundry.org/allow-deletion": "true"})
+			managed[2] = managedPolicy("asg-3", map[string]string{"policy-agent.cloudfoundry.org/allow-deletion": "true"})
+			fakeClient = newFakeClient(managed...)
+			r := reconciler.New(fakeClient, recorder, config, logger)
+
+			Expect(r.Reconcile(asgs, nil, workloads)).To(MatchError(ContainSubstring("1 of 4 policies")))
+			Expect(policyNames()).To(ConsistOf("asg-1", "asg-4"))
+		})
+	})
 })
+
+func appPod(namespace, spaceGUID, appGUID string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appGUID,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"cloudfoundry.org/space-guid": spaceGUID,
+				"cloudfoundry.org/app-guid":   appGUID,
+			},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package reconciler
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/metrics"
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	"code.cloudfoundry.org/lager/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StatusConfigMapName is the name of the ConfigMap in the agent namespace
+// which summarises the last reconcile pass.
+const StatusConfigMapName = "policy-agent-status"
+
+const (
+	ReasonCreated                = "Created"
+	ReasonUpdated                = "Updated"
+	ReasonDeleted                = "Deleted"
+	ReasonCreateFailed           = "CreateFailed"
+	ReasonUpdateFailed           = "UpdateFailed"
+	ReasonDeleteFailed           = "DeleteFailed"
+	ReasonTranslationDiagnostics = "TranslationDiagnostics"
+	ReasonReconciled             = "Reconciled"
+	ReasonReconcileFailed        = "ReconcileFailed"
+	ReasonDeletionsWithheld      = "DeletionsWithheld"
+	ReasonDriftDetected          = "DriftDetected"
+	ReasonDriftReverted          = "DriftReverted"
+)
+
+const (
+	ActionCreate    = "Create"
+	ActionUpdate    = "Update"
+	ActionDelete    = "Delete"
+	ActionTranslate = "Translate"
+	ActionReconcile = "Reconcile"
+)
+
+// status counts the outcome of a single reconcile pass.
+type status struct {
+	securityGroups      int
+	c2cPolicies         int
+	created             int
+	updated             int
+	deleted             int
+	unchanged           int
+	drifted             int
+	failed              int
+	withheld            int
+	translationWarnings int
+	translationErrors   int
+}
+
+func (s *status) count(operation string, policy client.Object) {
+	switch operation {
+	case metrics.OperationCreated:
+		s.created++
+	case metrics.OperationUpdated:
+		s.updated++
+	case metrics.OperationUnchanged:
+		s.unchanged++
+	case metrics.OperationDrifted:
+		s.drifted++
+	}
+
+	warnings, _ := strconv.Atoi(policy.GetAnnotations()[types.TranslationWarningsAnnotationKey])
+	errors, _ := strconv.Atoi(policy.GetAnnotations()[types.TranslationErrorsAnnotationKey])
+	s.translationWarnings += warnings
+	s.translationErrors += errors
+}
+
+func (s *status) changed() bool {
+	return s.created+s.updated+s.deleted > 0
+}
+
+// recordStatus writes the status ConfigMap and records a summary Event
+// against it if the pass changed any CiliumNetworkPolicy, withheld deletions
+// or failed.
+func (r *networkPolicyReconciler) recordStatus(s *status, reconcileErr error) {
+	result := metrics.ResultSuccess
+	if reconcileErr != nil {
+		result = metrics.ResultError
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      StatusConfigMapName,
+			Namespace: r.config.Namespace,
+			Labels: map[string]string{
+				types.NetworkPoliciesAppLabelKey: types.NetworkPoliciesAppLabelValue,
+			},
+		},
+		Data: map[string]string{
+			"last-reconcile":       time.Now().UTC().Format(time.RFC3339),
+			"result":               result,
+			"security-groups":      strconv.Itoa(s.securityGroups),
+			"c2c-policies":         strconv.Itoa(s.c2cPolicies),
+			"created":              strconv.Itoa(s.created),
+			"updated":              strconv.Itoa(s.updated),
+			"deleted":              strconv.Itoa(s.deleted),
+			"unchanged":            strconv.Itoa(s.unchanged),
+			"drifted":              strconv.Itoa(s.drifted),
+			"failed":               strconv.Itoa(s.failed),
+			"withheld-deletions":   strconv.Itoa(s.withheld),
+			"translation-warnings": strconv.Itoa(s.translationWarnings),
+			"translation-errors":   strconv.Itoa(s.translationErrors),
+		},
+	}
+	if reconcileErr != nil {
+		configMap.Data["error"] = reconcileErr.Error()
+	}
+
+	// update first to avoid reading ConfigMaps through the manager cache,
+	// which would start an informer for every ConfigMap in the cluster
+	err := r.k8sclient.Update(context.Background(), configMap)
+	if apierrors.IsNotFound(err) {
+		err = r.k8sclient.Create(context.Background(), configMap)
+	}
+	if err != nil {
+		r.logger.Error("failed to write status ConfigMap", err, lager.Data{"name": StatusConfigMapName})
+		return
+	}
+
+	if s.withheld > 0 {
+		r.recorder.Eventf(configMap, nil, corev1.EventTypeWarning, ReasonDeletionsWithheld, ActionDelete,
+			"withheld deletion of %d obsolete CiliumNetworkPolicies exceeding the deletion guard, annotate them with %s=true to delete them",
+			s.withheld, types.AllowDeletionAnnotationKey)
+	}
+
+	if s.failed > 0 {
+		r.recorder.Eventf(configMap, nil, corev1.EventTypeWarning, ReasonReconcileFailed, ActionReconcile,
+			"failed to reconcile %d CiliumNetworkPolicies, see the status ConfigMap for details", s.failed)
+		return
+	}
+
+	if s.changed() {
+		r.recorder.Eventf(configMap, nil, corev1.EventTypeNormal, ReasonReconciled, ActionReconcile,
+			"created %d, updated %d and deleted %d CiliumNetworkPolicies", s.created, s.updated, s.deleted)
+	}
+}
@@ -3,103 +3,360 @@ package reconciler
 import (
 	"errors"
 	"fmt"
-	"log"
-	"math/bits"
-	"net"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
 
 	policy "code.cloudfoundry.org/policy_client"
 	slimv1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
 	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
-func CreateCiliumEgressRulesFromASG(asgRules []policy.SecurityGroupRule) []ciliumapi.EgressRule {
+// TranslationOptions enables translations which depend on optional Cilium
+// features.
+type TranslationOptions struct {
+	// FQDNDestinations translates hostname and wildcard hostname destinations
+	// into ToFQDNs rules, which requires the Cilium DNS proxy.
+	FQDNDestinations bool
+	// StrictICMPCodes drops ICMP rules restricted to codes which Cilium cannot
+	// express, instead of allowing every code of their type.
+	StrictICMPCodes bool
+}
+
+const (
+	dnsNamespace     = "kube-system"
+	dnsLabelKey      = "k8s:k8s-app"
+	dnsLabelValue    = "kube-dns"
+	dnsPort          = "53"
+	wildcardHostname = "*."
+)
+
+// TranslatedRule holds the Cilium egress rules translated from a single ASG
+// rule together with the rule's description and log flag.
+type TranslatedRule struct {
+	Index       int
+	Description string
+	Log         bool
+	Egress      []ciliumapi.EgressRule
+}
+
+// CreateCiliumEgressRulesFromASG translates the rules of an ASG into Cilium
+// egress rules, merging rules which allow the same ports. Destinations, ports
+// and rules which cannot be translated are dropped and reported as
+// diagnostics.
+func CreateCiliumEgressRulesFromASG(asg policy.SecurityGroup, options TranslationOptions) ([]ciliumapi.EgressRule, Diagnostics) {
+	translatedRules, diagnostics := TranslateASGRules(asg, options)
+
 	var ciliumEgressRules []ciliumapi.EgressRule
+	for _, translated := range translatedRules {
+		ciliumEgressRules = append(ciliumEgressRules, translated.Egress...)
+	}
+
+	return WithDNSVisibility(aggregateEgressRules(ciliumEgressRules), ciliumEgressRules), diagnostics
+}
+
+// TranslateASGRules translates every rule of an ASG into Cilium egress rules
+// with canonical and aggregated CIDRs. Destinations, ports and rules which
+// cannot be translated are dropped and reported as diagnostics.
+func TranslateASGRules(asg policy.SecurityGroup, options TranslationOptions) ([]TranslatedRule, Diagnostics) {
+	var (
+		translatedRules []TranslatedRule
+		diagnostics     Diagnostics
+	)
+
+	for i, rule := range asg.Rules {
+		diagnose := func(field, value, reason string, severity Severity) {
+			diagnostics = append(diagnostics, Diagnostic{
+				ASGGUID:   asg.Guid,
+				RuleIndex: i,
+				Field:     field,
+				Value:     value,
+				Reason:    reason,
+				Severity:  severity,
+			})
+		}
 
-	for _, rule := range asgRules {
 		cidrsList := []ciliumapi.CIDR{}
+		fqdns := ciliumapi.FQDNSelectorSlice{}
 		for destination := range strings.SplitSeq(rule.Destination, ",") {
+			if fqdn, ok := toFQDNSelector(destination); ok {
+				if !options.FQDNDestinations {
+					diagnose(FieldDestination, destination, "hostname destinations are not enabled", SeverityWarning)
+					continue
+				}
+				if !slices.Contains(fqdns, fqdn) {
+					fqdns = append(fqdns, fqdn)
+				}
+				continue
+			}
+
 			cidrs, err := translateToCidrs(destination)
 			if err != nil {
-				log.Printf("invalid destination %q (rule will be ignored): %v", destination, err)
+				diagnose(FieldDestination, destination, err.Error(), SeverityWarning)
 				continue
 			}
 			cidrsList = append(cidrsList, cidrs...)
 		}
-		if len(cidrsList) == 0 {
-			log.Printf("no valid destination found in %q (rule will be ignored)", rule.Destination)
+		if len(cidrsList) == 0 && len(fqdns) == 0 {
+			diagnose(FieldDestination, rule.Destination, "no valid destination", SeverityError)
 			continue
 		}
 
-		egressRule := ciliumapi.EgressRule{
-			EgressCommonRule: ciliumapi.EgressCommonRule{
-				ToCIDR: cidrsList,
-			},
-		}
+		egressRule := ciliumapi.EgressRule{}
 
 		switch rule.Protocol {
-		case "tcp":
-			egressRule.ToPorts = toPorts(rule.Ports, ciliumapi.ProtoTCP)
-		case "udp":
-			egressRule.ToPorts = toPorts(rule.Ports, ciliumapi.ProtoUDP)
-		case "icmp":
-			egressRule.ICMPs = icmpRule(rule.Type, ciliumapi.IPv4Family)
-		case "icmpv6":
-			egressRule.ICMPs = icmpRule(rule.Type, ciliumapi.IPv6Family)
+		case "tcp", "udp":
+			portRules, invalidPorts := toPorts(rule.Ports, ciliumapi.L4Proto(strings.ToUpper(rule.Protocol)))
+			for _, invalid := range invalidPorts {
+				diagnose(FieldPorts, invalid.entry, invalid.reason, SeverityWarning)
+			}
+			// a rule without ports would allow all ports for given destinations
+			if len(portRules) == 0 {
+				diagnose(FieldPorts, rule.Ports, "no valid port", SeverityError)
+				continue
+			}
+			egressRule.ToPorts = portRules
+		case "icmp", "icmpv6":
+			family := ciliumapi.IPv4Family
+			if rule.Protocol == "icmpv6" {
+				family = ciliumapi.IPv6Family
+			}
+			// Cilium ICMP rules only match on types, a rule restricted to
+			// some codes of a type can only be widened to the whole type
+			if !icmpCodeExpressible(rule.Type, rule.Code, family) {
+				if options.StrictICMPCodes {
+					diagnose(FieldCode, strconv.Itoa(rule.Code), "ICMP codes cannot be restricted in Cilium policies", SeverityError)
+					continue
+				}
+				diagnose(FieldCode, strconv.Itoa(rule.Code), "ICMP codes cannot be restricted in Cilium policies, allowing all codes", SeverityWarning)
+			}
+			egressRule.ICMPs = icmpRule(rule.Type, family)
 		case "all":
 			// do not set any ports or ICMPs to allow all protocols for given destinations
 		default:
 			// we need to continue for unsupported protocols to
 			// avoid adding empty rules which would allow all traffic
-			log.Printf("unsupported protocol %q (rule will be ignored)", rule.Protocol)
+			diagnose(FieldProtocol, rule.Protocol, "unsupported protocol", SeverityError)
 			continue
 		}
 
-		ciliumEgressRules = append(ciliumEgressRules, egressRule)
+		translated := TranslatedRule{
+			Index:       i,
+			Description: rule.Description,
+			Log:         rule.Log,
+		}
+
+		// Cilium does not allow combining ToCIDR and ToFQDNs in one rule
+		if len(cidrsList) > 0 {
+			cidrRule := *egressRule.DeepCopy()
+			cidrRule.ToCIDR = aggregateCIDRs(cidrsList)
+			translated.Egress = append(translated.Egress, cidrRule)
+		}
+		if len(fqdns) > 0 {
+			fqdnRule := *egressRule.DeepCopy()
+			fqdnRule.ToFQDNs = fqdns
+			translated.Egress = append(translated.Egress, fqdnRule)
+		}
+
+		translatedRules = append(translatedRules, translated)
 	}
 
-	return ciliumEgressRules
+	return translatedRules, diagnostics
 }
 
-func toPorts(portStr string, protocol ciliumapi.L4Proto) []ciliumapi.PortRule {
-	if portStr == "" {
-		portStr = "1-65535"
+// WithDNSVisibility appends the DNS visibility rule to egressRules if any of
+// the egress rules of the same endpoints, passed as all, has ToFQDNs.
+func WithDNSVisibility(egressRules, all []ciliumapi.EgressRule) []ciliumapi.EgressRule {
+	if !slices.ContainsFunc(all, func(rule ciliumapi.EgressRule) bool { return len(rule.ToFQDNs) > 0 }) {
+		return egressRules
 	}
+	return append(egressRules, dnsVisibilityRule())
+}
 
-	var portRules []ciliumapi.PortRule
-	for _, port := range strings.Split(portStr, ",") {
-		portRange := strings.SplitN(strings.TrimSpace(port), "-", 2)
-
-		var (
-			startPort string
-			endPort   int64
-			err       error
-		)
-		if len(portRange) == 2 {
-			startPort = portRange[0]
-			endPort, err = strconv.ParseInt(portRange[1], 10, 32)
-			if err != nil {
-				continue
-			}
-		} else {
-			startPort = portRange[0]
-			endPort, err = strconv.ParseInt(portRange[0], 10, 32)
-			if err != nil {
-				continue
-			}
+// toFQDNSelector returns a selector for hostname and wildcard hostname
+// destinations like "api.example.com" or "*.example.com".
+func toFQDNSelector(destination string) (ciliumapi.FQDNSelector, bool) {
+	hostname := strings.ToLower(strings.TrimSpace(destination))
+	name, wildcard := strings.CutPrefix(hostname, wildcardHostname)
+
+	if len(validation.IsDNS1123Subdomain(name)) > 0 {
+		return ciliumapi.FQDNSelector{}, false
+	}
+
+	// a numeric top-level label is an IP address or range, not a hostname
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 || !strings.ContainsFunc(labels[len(labels)-1], unicode.IsLetter) {
+		return ciliumapi.FQDNSelector{}, false
+	}
+
+	if wildcard {
+		return ciliumapi.FQDNSelector{MatchPattern: hostname}, true
+	}
+	return ciliumapi.FQDNSelector{MatchName: hostname}, true
+}
+
+// dnsVisibilityRule allows DNS lookups through kube-dns and lets the Cilium
+// DNS proxy observe them, which is required to resolve ToFQDNs rules.
+func dnsVisibilityRule() ciliumapi.EgressRule {
+	return ciliumapi.EgressRule{
+		EgressCommonRule: ciliumapi.EgressCommonRule{
+			ToEndpoints: []ciliumapi.EndpointSelector{{
+				LabelSelector: &slimv1.LabelSelector{
+					MatchLabels: map[string]string{
+						types.PodNamespaceLabelKey: dnsNamespace,
+						dnsLabelKey:                dnsLabelValue,
+					},
+				},
+			}},
+		},
+		ToPorts: ciliumapi.PortRules{{
+			Ports: []ciliumapi.PortProtocol{{Port: dnsPort, Protocol: ciliumapi.ProtoAny}},
+			Rules: &ciliumapi.L7Rules{
+				DNS: []ciliumapi.PortRuleDNS{{MatchPattern: "*"}},
+			},
+		}},
+	}
+}
+
+const (
+	minPort = 1
+	maxPort = 65535
+)
+
+// invalidPort describes an invalid entry of a comma separated list of ports.
+type invalidPort struct {
+	entry  string
+	reason string
+}
+
+// toPorts returns one port rule per range of a comma separated list of ports
+// and port ranges, with overlapping ranges merged, together with every invalid
+// entry.
+func toPorts(portStr string, protocol ciliumapi.L4Proto) ([]ciliumapi.PortRule, []invalidPort) {
+	if strings.TrimSpace(portStr) == "" {
+		portStr = fmt.Sprintf("%d-%d", minPort, maxPort)
+	}
+
+	var (
+		ranges [][2]int
+		errs   []invalidPort
+	)
+	for entry := range strings.SplitSeq(portStr, ",") {
+		entry = strings.TrimSpace(entry)
+		portRange, err := parsePortRange(entry)
+		if err != nil {
+			errs = append(errs, invalidPort{entry: entry, reason: err.Error()})
+			continue
 		}
+		ranges = append(ranges, portRange)
+	}
 
+	var portRules []ciliumapi.PortRule
+	for _, portRange := range mergePortRanges(ranges) {
 		portRules = append(portRules, ciliumapi.PortRule{
 			Ports: []ciliumapi.PortProtocol{{
-				Port:     startPort,
-				EndPort:  int32(endPort),
+				Port:     strconv.Itoa(portRange[0]),
+				EndPort:  int32(portRange[1]),
 				Protocol: protocol,
 			}},
 		})
 	}
-	return portRules
+	return portRules, errs
+}
+
+// parsePortRange parses a single port like "80" or a port range like
+// "8080-8090" into its first and last port.
+func parsePortRange(entry string) ([2]int, error) {
+	if entry == "" {
+		return [2]int{}, errors.New("empty port")
+	}
+
+	first, last, isRange := strings.Cut(entry, "-")
+	start, err := parsePort(first)
+	if err != nil {
+		return [2]int{}, err
+	}
+	if !isRange {
+		return [2]int{start, start}, nil
+	}
+
+	end, err := parsePort(last)
+	if err != nil {
+		return [2]int{}, err
+	}
+	if start > end {
+		return [2]int{}, errors.New("start port is greater than end port")
+	}
+	return [2]int{start, end}, nil
+}
+
+func parsePort(s string) (int, error) {
+	// ParseUint rejects signs, which Atoi would accept
+	port, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0, errors.New("port is not a number")
+	}
+	if port < minPort || port > maxPort {
+		return 0, fmt.Errorf("port is not within %d-%d", minPort, maxPort)
+	}
+	return int(port), nil
+}
+
+// mergePortRanges sorts port ranges and merges the ones which overlap.
+func mergePortRanges(ranges [][2]int) [][2]int {
+	slices.SortFunc(ranges, func(a, b [2]int) int { return a[0] - b[0] })
+
+	var merged [][2]int
+	for _, portRange := range ranges {
+		if len(merged) > 0 && portRange[0] <= merged[len(merged)-1][1] {
+			merged[len(merged)-1][1] = max(merged[len(merged)-1][1], portRange[1])
+			continue
+		}
+		merged = append(merged, portRange)
+	}
+	return merged
+}
+
+// singleCodeIcmpTypes lists the ICMP types which only define code 0, so a
+// rule for code 0 of these types allows exactly the whole type.
+var singleCodeIcmpTypes = map[string][]int{
+	ciliumapi.IPv4Family: {
+		0,  // EchoReply
+		8,  // Echo/EchoRequest
+		10, // RouterSelection
+		13, // Timestamp
+		14, // TimestampReply
+		42, // ExtendedEchoRequest
+	},
+	ciliumapi.IPv6Family: {
+		2,   // PacketTooBig
+		128, // EchoRequest
+		129, // EchoReply
+		130, // MulticastListenerQuery
+		131, // MulticastListenerReport
+		132, // MulticastListenerDone
+		133, // RouterSolicitation
+		134, // RouterAdvertisement
+		135, // NeighborSolicitation
+		136, // NeighborAdvertisement
+		137, // RedirectMessage
+	},
+}
+
+// icmpCodeExpressible reports whether a Cilium ICMP rule, which cannot match
+// on codes, allows exactly the codes of the ASG rule. Code -1 allows all
+// codes of the type.
+func icmpCodeExpressible(icmpType, code int, ipFamily string) bool {
+	if code == -1 {
+		return true
+	}
+	return code == 0 && slices.Contains(singleCodeIcmpTypes[ipFamily], icmpType)
 }
 
 func icmpRule(icmpType int, ipFamily ...string) ciliumapi.ICMPRules {
@@ -181,112 +438,120 @@ func GetIcmpTypes(ipFamily string) []int32 {
 	}
 }
 
+// translateToCidrs validates and canonicalises a CIDR, IP range or single IP
+// of either address family into CIDRs.
 func translateToCidrs(destination string) ([]ciliumapi.CIDR, error) {
+	destination = strings.TrimSpace(destination)
 	if destination == "" {
 		return nil, errors.New("empty destination")
 	}
 
 	if strings.Contains(destination, "/") {
-		return []ciliumapi.CIDR{ciliumapi.CIDR(destination)}, nil
+		prefix, err := netip.ParsePrefix(destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", destination)
+		}
+		// IPv4-mapped prefixes covering only IPv4 addresses are treated as
+		// IPv4, like IPv4-mapped hosts
+		if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+		}
+		return []ciliumapi.CIDR{ciliumapi.CIDR(prefix.String())}, nil
 	}
 
 	if strings.Contains(destination, "-") {
 		return ipRangeToCIDRs(destination)
 	}
 
-	return []ciliumapi.CIDR{ciliumapi.CIDR(destination + "/32")}, nil
+	addr, err := parseAddr(destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %s", destination)
+	}
+
+	return []ciliumapi.CIDR{ciliumapi.CIDR(netip.PrefixFrom(addr, addr.BitLen()).String())}, nil
 }
 
-// converts an IP range (e.g., "169.255.0.0-172.15.255.255") to minimal set of CIDRs
+// parseAddr parses an IP address without zone, IPv4-mapped IPv6 addresses are
+// treated as IPv4.
+func parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("IP address with zone: %s", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// converts an IP range (e.g., "169.255.0.0-172.15.255.255" or
+// "2001:db8::-2001:db8::ff") to minimal set of CIDRs
 func ipRangeToCIDRs(ipRange string) ([]ciliumapi.CIDR, error) {
 	parts := strings.SplitN(ipRange, "-", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid IP range format: %s", ipRange)
 	}
 
-	startIP := net.ParseIP(strings.TrimSpace(parts[0]))
-	endIP := net.ParseIP(strings.TrimSpace(parts[1]))
+	startIP, startErr := parseAddr(parts[0])
+	endIP, endErr := parseAddr(parts[1])
 
-	if startIP == nil || endIP == nil {
+	if startErr != nil || endErr != nil {
 		return nil, fmt.Errorf("invalid IP addresses in range: %s", ipRange)
 	}
 
-	startIP = startIP.To4()
-	endIP = endIP.To4()
-
-	if startIP == nil || endIP == nil {
-		return nil, fmt.Errorf("only IPv4 ranges are supported: %s", ipRange)
+	if startIP.BitLen() != endIP.BitLen() {
+		return nil, fmt.Errorf("IP range mixes IPv4 and IPv6 addresses: %s", ipRange)
 	}
 
-	startInt := ipToUint32(startIP)
-	endInt := ipToUint32(endIP)
-
-	if startInt > endInt {
+	if startIP.Compare(endIP) > 0 {
 		return nil, fmt.Errorf("start IP is greater than end IP: %s", ipRange)
 	}
 
-	return rangeToCIDRs(startInt, endInt), nil
-}
-
-// ipToUint32 converts an IPv4 address to a 32-bit unsigned integer
-func ipToUint32(ip net.IP) uint32 {
-	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
-}
-
-// uint32ToIP converts a 32-bit unsigned integer to an IPv4 address
-func uint32ToIP(n uint32) net.IP {
-	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
-}
-
-// rangeToCIDRs converts an IP range (as uint32) to minimal set of CIDRs
-// This uses an efficient algorithm that finds the largest aligned CIDR block
-// that fits at the start of the range, then recursively processes the remainder
-func rangeToCIDRs(start, end uint32) []ciliumapi.CIDR {
 	var cidrs []ciliumapi.CIDR
+	for _, prefix := range rangeToPrefixes(startIP, endIP) {
+		cidrs = append(cidrs, ciliumapi.CIDR(prefix.String()))
+	}
+	return cidrs, nil
+}
 
-	for start <= end {
-		// Find the maximum prefix length where start is aligned
-		// (i.e., how many trailing zeros in the binary representation)
-		maxPrefixLen := 32
-		if start != 0 {
-			maxPrefixLen = bits.TrailingZeros32(start)
-		}
-
-		// Calculate how many IPs we can cover from start to end
-		// Use uint64 to avoid overflow when end=0xFFFFFFFF and start=0
-		rangeSize := uint64(end) - uint64(start) + 1
-
-		// Find the largest CIDR block (smallest prefix) that:
-		// 1. Is aligned with start (respects maxPrefixLen)
-		// 2. Doesn't exceed the remaining range
-		prefixLen := 32
-		for p := maxPrefixLen; p >= 0; p-- {
-			blockSize := uint64(1) << p
-			if blockSize <= rangeSize {
-				prefixLen = 32 - p
+// rangeToPrefixes converts an IP range to minimal set of prefixes
+// This finds the largest aligned prefix that starts at the beginning of the
+// range and does not exceed its end, then continues after that prefix
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+
+	for {
+		// Widen the prefix while start stays its first address and its last
+		// address stays within the range
+		prefixLen := start.BitLen()
+		for prefixLen > 0 {
+			candidate := netip.PrefixFrom(start, prefixLen-1).Masked()
+			if candidate.Addr() != start || lastAddr(candidate).Compare(end) > 0 {
 				break
 			}
+			prefixLen--
 		}
 
-		// Create CIDR notation
-		cidr := ciliumapi.CIDR(fmt.Sprintf("%s/%d", uint32ToIP(start).String(), prefixLen))
-		cidrs = append(cidrs, cidr)
-
-		// if prefixLen is 0, we've covered the entire address space
-		if prefixLen == 0 {
-			break
-		}
+		prefix := netip.PrefixFrom(start, prefixLen)
+		prefixes = append(prefixes, prefix)
 
-		// Move to the next block
-		blockSize := uint32(1) << (32 - prefixLen)
-		if start > 0xFFFFFFFF-blockSize {
-			// Prevent overflow
-			break
+		// Comparing before moving on prevents overflow at the last address
+		last := lastAddr(prefix)
+		if last.Compare(end) >= 0 {
+			return prefixes
 		}
-		start += blockSize
+		start = last.Next()
 	}
+}
 
-	return cidrs
+// lastAddr returns the last address covered by the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(addr)*8; bit++ {
+		addr[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
 }
 
 // CreateCiliumEgressSelectorFromASG creates an endpoint selector based on ASG metadata
@@ -317,7 +582,7 @@ func CreateCiliumEgressSelectorsFromASG(asg policy.SecurityGroup) []slimv1.Label
 				{
 					Key:      "cloudfoundry.org/space-guid",
 					Operator: slimv1.LabelSelectorOpIn,
-					Values:   asg.RunningSpaceGuids,
+					Values:   slices.Sorted(slices.Values(asg.RunningSpaceGuids)),
 				},
 				{
 					Key:      "cloudfoundry.org/source-type",
@@ -333,7 +598,7 @@ func CreateCiliumEgressSelectorsFromASG(asg policy.SecurityGroup) []slimv1.Label
 				{
 					Key:      "cloudfoundry.org/space-guid",
 					Operator: slimv1.LabelSelectorOpIn,
-					Values:   asg.StagingSpaceGuids,
+					Values:   slices.Sorted(slices.Values(asg.StagingSpaceGuids)),
 				},
 				{
 					Key:      "cloudfoundry.org/source-type",
@@ -1,6 +1,13 @@
 package reconciler_test
 
 import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
 	policy "code.cloudfoundry.org/policy_client"
 	slimv1 "github.com/cilium/cilium/pkg/k8s/slim/k8s/apis/meta/v1"
 	ciliumapi "github.com/cilium/cilium/pkg/policy/api"
@@ -22,7 +29,7 @@ var _ = Describe("Translator", func() {
 					Ports:       "80,443",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.1/32")))
 			Expect(rules[0].ToPorts).To(HaveLen(2))
@@ -35,7 +42,7 @@ var _ = Describe("Translator", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{Destination: "10.0.0.8", Protocol: "icmp", Type: 8},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.8/32")))
 			Expect(rules[0].ToPorts).To(BeEmpty())
@@ -54,7 +61,7 @@ var _ = Describe("Translator", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{Destination: "10.0.0.8", Protocol: "icmp", Type: -1},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.8/32")))
 			Expect(rules[0].ToPorts).To(BeEmpty())
@@ -75,7 +82,7 @@ var _ = Describe("Translator", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{Destination: "10.0.0.8", Protocol: "icmpv6", Type: 8},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.8/32")))
 			Expect(rules[0].ToPorts).To(BeEmpty())
@@ -94,7 +101,7 @@ var _ = Describe("Translator", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{Destination: "10.0.0.8", Protocol: "icmpv6", Type: -1},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.8/32")))
 			Expect(rules[0].ToPorts).To(BeEmpty())
@@ -111,6 +118,35 @@ var _ = Describe("Translator", func() {
 			}
 		})
 
+		DescribeTable("ICMP codes", func(protocol string, icmpType, code int, strict bool, expectedSeverity reconciler.Severity) {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.8", Protocol: protocol, Type: icmpType, Code: code},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{StrictICMPCodes: strict})
+
+			switch expectedSeverity {
+			case "":
+				Expect(diagnostics).To(BeEmpty())
+				Expect(rules).To(HaveLen(1))
+			case reconciler.SeverityWarning:
+				Expect(diagnostics).To(ConsistOf(HaveField("Reason", "ICMP codes cannot be restricted in Cilium policies, allowing all codes")))
+				Expect(diagnostics[0].Field).To(Equal(reconciler.FieldCode))
+				Expect(rules).To(HaveLen(1))
+				Expect(rules[0].ICMPs[0].Fields).To(HaveLen(1))
+			case reconciler.SeverityError:
+				Expect(diagnostics).To(ConsistOf(HaveField("Severity", reconciler.SeverityError)))
+				Expect(rules).To(BeEmpty())
+			}
+		},
+			Entry("all codes of a type", "icmp", 3, -1, true, reconciler.Severity("")),
+			Entry("the only code of echo request", "icmp", 8, 0, true, reconciler.Severity("")),
+			Entry("the only code of ICMPv6 echo reply", "icmpv6", 129, 0, true, reconciler.Severity("")),
+			Entry("fragmentation needed in permissive mode", "icmp", 3, 4, false, reconciler.SeverityWarning),
+			Entry("fragmentation needed in strict mode", "icmp", 3, 4, true, reconciler.SeverityError),
+			Entry("code 0 of a type with several codes in strict mode", "icmpv6", 1, 0, true, reconciler.SeverityError),
+			Entry("a code of all types in strict mode", "icmp", -1, 0, true, reconciler.SeverityError),
+		)
+
 		It("creates egress rules for UDP protocol", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{
@@ -119,9 +155,9 @@ var _ = Describe("Translator", func() {
 					Ports:       "53",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
-			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.2/24")))
+			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.0/24")))
 			Expect(rules[0].ToPorts[0].Ports[0].Protocol).To(Equal(ciliumapi.ProtoUDP))
 		})
 
@@ -132,8 +168,8 @@ var _ = Describe("Translator", func() {
 					Protocol:    "all",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
-			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.9/24")))
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.0/24")))
 		})
 
 		It("does not create rules for unknown protocol", func() {
@@ -144,8 +180,16 @@ var _ = Describe("Translator", func() {
 					Ports:       "1234",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Guid: "asg-guid", Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(0))
+			Expect(diagnostics).To(ConsistOf(reconciler.Diagnostic{
+				ASGGUID:   "asg-guid",
+				RuleIndex: 0,
+				Field:     reconciler.FieldProtocol,
+				Value:     "foo",
+				Reason:    "unsupported protocol",
+				Severity:  reconciler.SeverityError,
+			}))
 		})
 
 		It("ignores rules with invalid destination", func() {
@@ -156,8 +200,81 @@ var _ = Describe("Translator", func() {
 					Ports:       "80",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(BeEmpty())
+			Expect(diagnostics).To(HaveLen(2))
+			Expect(diagnostics[0].Field).To(Equal(reconciler.FieldDestination))
+			Expect(diagnostics[0].Severity).To(Equal(reconciler.SeverityWarning))
+			Expect(diagnostics[1].Reason).To(Equal("no valid destination"))
+			Expect(diagnostics[1].Severity).To(Equal(reconciler.SeverityError))
+		})
+
+		It("keeps valid destinations and reports invalid ones", func() {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1,not-an-ip-", Protocol: "tcp", Ports: "80"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.1/32")))
+			Expect(diagnostics).To(HaveLen(1))
+			Expect(diagnostics[0].Value).To(Equal("not-an-ip-"))
+			Expect(diagnostics.Count(reconciler.SeverityWarning)).To(Equal(1))
+		})
+
+		It("reports invalid ports and drops rules without any valid port", func() {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1", Protocol: "tcp", Ports: "80,abc"},
+				{Destination: "10.0.0.2", Protocol: "udp", Ports: "xyz"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToPorts).To(HaveLen(1))
+			Expect(diagnostics.Count(reconciler.SeverityWarning)).To(Equal(2))
+			Expect(diagnostics.Count(reconciler.SeverityError)).To(Equal(1))
+			Expect(diagnostics[2].RuleIndex).To(Equal(1))
+			Expect(diagnostics[2].Reason).To(Equal("no valid port"))
+		})
+
+		DescribeTable("reports malformed ports", func(ports, entry, reason string) {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1", Protocol: "tcp", Ports: "443," + ports},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToPorts).To(ConsistOf(ciliumapi.PortRule{
+				Ports: []ciliumapi.PortProtocol{{Port: "443", EndPort: 443, Protocol: ciliumapi.ProtoTCP}},
+			}))
+			Expect(diagnostics).To(ConsistOf(reconciler.Diagnostic{
+				RuleIndex: 0,
+				Field:     reconciler.FieldPorts,
+				Value:     entry,
+				Reason:    reason,
+				Severity:  reconciler.SeverityWarning,
+			}))
+		},
+			Entry("port zero", "0", "0", "port is not within 1-65535"),
+			Entry("port above the maximum", "70000", "70000", "port is not within 1-65535"),
+			Entry("range end above the maximum", "80-70000", "80-70000", "port is not within 1-65535"),
+			Entry("reversed range", " 90-80 ", "90-80", "start port is greater than end port"),
+			Entry("non-numeric start port", "abc-90", "abc-90", "port is not a number"),
+			Entry("signed port", "+80", "+80", "port is not a number"),
+			Entry("empty entry", "", "", "empty port"),
+			Entry("open range", "80-", "80-", "port is not a number"),
+		)
+
+		It("merges overlapping port ranges", func() {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1", Protocol: "tcp", Ports: "8080-8090, 80,8085-8100,443, 80,81"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(diagnostics).To(BeEmpty())
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToPorts).To(Equal(ciliumapi.PortRules{
+				{Ports: []ciliumapi.PortProtocol{{Port: "80", EndPort: 80, Protocol: ciliumapi.ProtoTCP}}},
+				{Ports: []ciliumapi.PortProtocol{{Port: "81", EndPort: 81, Protocol: ciliumapi.ProtoTCP}}},
+				{Ports: []ciliumapi.PortProtocol{{Port: "443", EndPort: 443, Protocol: ciliumapi.ProtoTCP}}},
+				{Ports: []ciliumapi.PortProtocol{{Port: "8080", EndPort: 8100, Protocol: ciliumapi.ProtoTCP}}},
+			}))
 		})
 
 		It("creates rule without ports if Ports is empty", func() {
@@ -168,7 +285,7 @@ var _ = Describe("Translator", func() {
 					Ports:       "",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToPorts).To(ConsistOf(ciliumapi.PortRule{
 				Ports: []ciliumapi.PortProtocol{{
@@ -183,7 +300,7 @@ var _ = Describe("Translator", func() {
 			asgRules := []policy.SecurityGroupRule{
 				{Destination: "10.0.0.9", Protocol: "tcp", Ports: " 81 ,  82"},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules[0].ToPorts[0].Ports[0].Port).To(Equal("81"))
 			Expect(rules[0].ToPorts[1].Ports[0].Port).To(Equal("82"))
 		})
@@ -196,7 +313,7 @@ var _ = Describe("Translator", func() {
 					Ports:       "80",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf([]ciliumapi.CIDR{
 				ciliumapi.CIDR("10.0.0.0/32"),
@@ -205,6 +322,85 @@ var _ = Describe("Translator", func() {
 			}))
 		})
 
+		It("reports destinations which are neither IPs nor hostnames", func() {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1,foo_bar,10.0.0.0/33", Protocol: "tcp", Ports: "80"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.1/32")))
+			Expect(diagnostics).To(ConsistOf(
+				HaveField("Reason", "invalid destination: foo_bar"),
+				HaveField("Reason", "invalid CIDR: 10.0.0.0/33"),
+			))
+		})
+
+		Describe("hostname destinations", func() {
+			var asgRules []policy.SecurityGroupRule
+
+			BeforeEach(func() {
+				asgRules = []policy.SecurityGroupRule{
+					{Destination: "10.0.0.1,API.example.com,*.saas.example.io", Protocol: "tcp", Ports: "443"},
+					{Destination: "db.example.com", Protocol: "tcp", Ports: "5432"},
+				}
+			})
+
+			It("reports hostnames unless FQDN destinations are enabled", func() {
+				rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+				Expect(rules).To(HaveLen(1))
+				Expect(rules[0].ToFQDNs).To(BeEmpty())
+				Expect(diagnostics.Count(reconciler.SeverityWarning)).To(Equal(3))
+				Expect(diagnostics.Count(reconciler.SeverityError)).To(Equal(1))
+				Expect(diagnostics[0].Reason).To(Equal("hostname destinations are not enabled"))
+			})
+
+			It("translates hostnames into ToFQDNs rules next to the CIDR rules", func() {
+				rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{FQDNDestinations: true})
+				Expect(diagnostics).To(BeEmpty())
+				Expect(rules).To(HaveLen(4))
+
+				Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.1/32")))
+				Expect(rules[0].ToFQDNs).To(BeEmpty())
+				Expect(rules[1].ToCIDR).To(BeEmpty())
+				Expect(rules[1].ToFQDNs).To(ConsistOf(
+					ciliumapi.FQDNSelector{MatchName: "api.example.com"},
+					ciliumapi.FQDNSelector{MatchPattern: "*.saas.example.io"},
+				))
+				Expect(rules[1].ToPorts).To(Equal(rules[0].ToPorts))
+				Expect(rules[2].ToFQDNs).To(ConsistOf(ciliumapi.FQDNSelector{MatchName: "db.example.com"}))
+			})
+
+			It("adds a single DNS visibility rule for kube-dns", func() {
+				rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{FQDNDestinations: true})
+
+				dnsRule := rules[len(rules)-1]
+				Expect(dnsRule.ToEndpoints).To(HaveLen(1))
+				Expect(dnsRule.ToEndpoints[0].LabelSelector.MatchLabels).To(Equal(map[string]string{
+					"k8s:io.kubernetes.pod.namespace": "kube-system",
+					"k8s:k8s-app":                     "kube-dns",
+				}))
+				Expect(dnsRule.ToPorts).To(ConsistOf(ciliumapi.PortRule{
+					Ports: []ciliumapi.PortProtocol{{Port: "53", Protocol: ciliumapi.ProtoAny}},
+					Rules: &ciliumapi.L7Rules{DNS: []ciliumapi.PortRuleDNS{{MatchPattern: "*"}}},
+				}))
+			})
+
+			It("does not add a DNS visibility rule without hostnames", func() {
+				rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules[:1]}, reconciler.TranslationOptions{})
+				for _, rule := range rules {
+					Expect(rule.ToEndpoints).To(BeEmpty())
+				}
+			})
+
+			It("does not treat IP ranges as hostnames", func() {
+				rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+					{Destination: "10.0.0.0-10.0.0.7", Protocol: "tcp", Ports: "80"},
+				}}, reconciler.TranslationOptions{FQDNDestinations: true})
+				Expect(rules).To(HaveLen(1))
+				Expect(rules[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.0/29")))
+			})
+		})
+
 		DescribeTable("IP ranges", func(ipRange string, expectedCIDRs []ciliumapi.CIDR) {
 			asgRules := []policy.SecurityGroupRule{
 				{
@@ -213,7 +409,7 @@ var _ = Describe("Translator", func() {
 					Ports:       "80",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(HaveLen(1))
 			Expect(rules[0].ToCIDR).To(ConsistOf(expectedCIDRs))
 		},
@@ -240,6 +436,58 @@ var _ = Describe("Translator", func() {
 				ciliumapi.CIDR("0.0.0.0/32"),
 				ciliumapi.CIDR("10.0.0.5/32"),
 			}),
+			Entry("IPv6 range within a /120", "2001:db8::-2001:db8::ff", []ciliumapi.CIDR{
+				ciliumapi.CIDR("2001:db8::/120"),
+			}),
+			Entry("complex IPv6 range", "2001:db8::1-2001:db8::10", []ciliumapi.CIDR{
+				ciliumapi.CIDR("2001:db8::1/128"),
+				ciliumapi.CIDR("2001:db8::2/127"),
+				ciliumapi.CIDR("2001:db8::4/126"),
+				ciliumapi.CIDR("2001:db8::8/125"),
+				ciliumapi.CIDR("2001:db8::10/128"),
+			}),
+			Entry("maximal IPv6 range", "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []ciliumapi.CIDR{
+				ciliumapi.CIDR("::/0"),
+			}),
+			Entry("IPv6 range that stops at the last address", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []ciliumapi.CIDR{
+				ciliumapi.CIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"),
+			}),
+			Entry("canonicalised IPv6 range", "2001:DB8:0:0::0-2001:db8::0:3", []ciliumapi.CIDR{
+				ciliumapi.CIDR("2001:db8::/126"),
+			}),
+			Entry("IPv4-mapped IPv6 range", "::ffff:10.0.0.0-::ffff:10.0.0.3", []ciliumapi.CIDR{
+				ciliumapi.CIDR("10.0.0.0/30"),
+			}),
+		)
+
+		DescribeTable("single addresses and CIDRs", func(destination string, expectedCIDR ciliumapi.CIDR) {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: destination, Protocol: "tcp", Ports: "80"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(diagnostics).To(BeEmpty())
+			Expect(rules[0].ToCIDR).To(ConsistOf(expectedCIDR))
+		},
+			Entry("IPv4 host", "10.0.0.1", ciliumapi.CIDR("10.0.0.1/32")),
+			Entry("IPv6 host", "2001:db8::1", ciliumapi.CIDR("2001:db8::1/128")),
+			Entry("non-canonical IPv6 host", "2001:0DB8:0000::0001", ciliumapi.CIDR("2001:db8::1/128")),
+			Entry("IPv4-mapped IPv6 host", "::ffff:10.0.0.1", ciliumapi.CIDR("10.0.0.1/32")),
+			Entry("IPv6 CIDR", "2001:DB8::/32", ciliumapi.CIDR("2001:db8::/32")),
+			Entry("IPv4-mapped IPv6 CIDR", "::ffff:10.0.0.0/104", ciliumapi.CIDR("10.0.0.0/8")),
+		)
+
+		DescribeTable("invalid destinations", func(destination, reason string) {
+			asgRules := []policy.SecurityGroupRule{
+				{Destination: destination, Protocol: "tcp", Ports: "80"},
+			}
+			rules, diagnostics := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
+			Expect(rules).To(BeEmpty())
+			Expect(diagnostics[0].Reason).To(Equal(reason))
+		},
+			Entry("IPv6 host with zone", "fe80::1%eth0", "invalid destination: fe80::1%eth0"),
+			Entry("IPv6 CIDR out of bounds", "2001:db8::/129", "invalid CIDR: 2001:db8::/129"),
+			Entry("mixed address families", "10.0.0.1-2001:db8::1", "IP range mixes IPv4 and IPv6 addresses: 10.0.0.1-2001:db8::1"),
+			Entry("reversed IPv6 range", "2001:db8::ff-2001:db8::1", "start IP is greater than end IP: 2001:db8::ff-2001:db8::1"),
 		)
 
 		It("fails if the IP is invalid", func() {
@@ -250,7 +498,7 @@ var _ = Describe("Translator", func() {
 					Ports:       "80",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(BeEmpty())
 		})
 
@@ -262,11 +510,102 @@ var _ = Describe("Translator", func() {
 					Ports:       "80",
 				},
 			}
-			rules := reconciler.CreateCiliumEgressRulesFromASG(asgRules)
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: asgRules}, reconciler.TranslationOptions{})
 			Expect(rules).To(BeEmpty())
 		})
 	})
 
+	Describe("CIDR aggregation", func() {
+		It("canonicalises CIDRs and drops duplicate and contained destinations", func() {
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "10.1.2.3/8,10.1.2.3,10.0.0.0/8,192.168.0.1,192.168.0.1/32", Protocol: "tcp", Ports: "80"},
+			}}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToCIDR).To(Equal(ciliumapi.CIDRSlice{"10.0.0.0/8", "192.168.0.1/32"}))
+		})
+
+		It("merges adjacent destinations", func() {
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "10.0.0.0/25,10.0.0.128-10.0.0.255,10.0.1.0/24,2001:db8::/33,2001:db8:8000::/33", Protocol: "tcp", Ports: "80"},
+			}}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].ToCIDR).To(Equal(ciliumapi.CIDRSlice{"10.0.0.0/23", "2001:db8::/32"}))
+		})
+
+		It("merges rules allowing the same ports", func() {
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "10.0.0.0/24", Protocol: "tcp", Ports: "80,443"},
+				{Destination: "10.0.0.0/24", Protocol: "udp", Ports: "53"},
+				{Destination: "10.0.1.0/24,10.0.0.1", Protocol: "tcp", Ports: "80,443"},
+				{Destination: "10.0.2.0/24", Protocol: "tcp", Ports: "443,80"},
+			}}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0].ToCIDR).To(Equal(ciliumapi.CIDRSlice{"10.0.0.0/23", "10.0.2.0/24"}))
+			Expect(rules[0].ToPorts).To(HaveLen(2))
+			Expect(rules[1].ToCIDR).To(Equal(ciliumapi.CIDRSlice{"10.0.0.0/24"}))
+			Expect(rules[1].ToPorts[0].Ports[0].Protocol).To(Equal(ciliumapi.ProtoUDP))
+		})
+
+		It("does not merge CIDR and FQDN rules", func() {
+			rules, _ := reconciler.CreateCiliumEgressRulesFromASG(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "10.0.0.0/24,example.com", Protocol: "tcp", Ports: "443"},
+				{Destination: "example.com,example.org", Protocol: "tcp", Ports: "443"},
+			}}, reconciler.TranslationOptions{FQDNDestinations: true})
+			Expect(rules).To(HaveLen(3))
+			Expect(rules[0].ToCIDR).To(Equal(ciliumapi.CIDRSlice{"10.0.0.0/24"}))
+			Expect(rules[0].ToFQDNs).To(BeEmpty())
+			Expect(rules[1].ToCIDR).To(BeEmpty())
+			Expect(rules[1].ToFQDNs).To(ConsistOf(
+				ciliumapi.FQDNSelector{MatchName: "example.com"},
+				ciliumapi.FQDNSelector{MatchName: "example.org"},
+			))
+			Expect(rules[2].ToEndpoints).NotTo(BeEmpty())
+		})
+
+		It("allows exactly the traffic allowed by the ASG", func() {
+			random := rand.New(rand.NewPCG(uint64(GinkgoRandomSeed()), 0))
+			for range 200 {
+				asg := randomASG(random)
+				rules, _ := reconciler.CreateCiliumEgressRulesFromASG(asg, reconciler.TranslationOptions{})
+
+				for _, probe := range probes {
+					for addr := probeNetwork.Addr(); probeNetwork.Contains(addr); addr = addr.Next() {
+						Expect(egressAllows(rules, addr, probe)).To(Equal(asgAllows(asg, addr, probe)),
+							"ASG rules %+v, %s %s:%d", asg.Rules, probe.protocol, addr, probe.port)
+					}
+				}
+			}
+		})
+	})
+
+	Describe("TranslateASGRules", func() {
+		It("keeps the index, description and log flag of every rule", func() {
+			rules, _ := reconciler.TranslateASGRules(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "10.0.0.1", Protocol: "tcp", Ports: "80", Description: "web"},
+				{Destination: "10.0.0.2", Protocol: "udp", Ports: "53", Log: true},
+			}}, reconciler.TranslationOptions{})
+			Expect(rules).To(HaveLen(2))
+			Expect(rules[0].Index).To(Equal(0))
+			Expect(rules[0].Description).To(Equal("web"))
+			Expect(rules[0].Log).To(BeFalse())
+			Expect(rules[0].Egress).To(HaveLen(1))
+			Expect(rules[0].Egress[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.1/32")))
+			Expect(rules[1].Index).To(Equal(1))
+			Expect(rules[1].Description).To(BeEmpty())
+			Expect(rules[1].Log).To(BeTrue())
+			Expect(rules[1].Egress[0].ToCIDR).To(ConsistOf(ciliumapi.CIDR("10.0.0.2/32")))
+		})
+
+		It("does not add the DNS visibility rule to the translated rules", func() {
+			rules, _ := reconciler.TranslateASGRules(policy.SecurityGroup{Rules: []policy.SecurityGroupRule{
+				{Destination: "example.com", Protocol: "tcp", Ports: "443"},
+			}}, reconciler.TranslationOptions{FQDNDestinations: true})
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].Egress).To(HaveLen(1))
+			Expect(rules[0].Egress[0].ToFQDNs).To(HaveLen(1))
+		})
+	})
+
 	Describe("CreateCiliumEgressSelectorFromASG", func() {
 		It("returns selector for staging only", func() {
 			asg := policy.SecurityGroup{StagingDefault: true, RunningDefault: false}
@@ -565,3 +904,117 @@ var _ = Describe("Translator", func() {
 		})
 	})
 })
+
+// probeNetwork holds the destinations of random ASGs, every address in it is
+// probed when comparing the traffic allowed by an ASG and its translation.
+var probeNetwork = netip.MustParsePrefix("10.0.0.0/22")
+
+type probe struct {
+	protocol string
+	port     int
+}
+
+var probes = []probe{{"tcp", 80}, {"tcp", 443}, {"tcp", 1500}, {"udp", 53}, {"udp", 443}}
+
+func randomASG(random *rand.Rand) policy.SecurityGroup {
+	randomAddr := func() netip.Addr {
+		addr := probeNetwork.Addr().As4()
+		offset := random.IntN(1 << (32 - probeNetwork.Bits()))
+		addr[2] += byte(offset >> 8)
+		addr[3] += byte(offset)
+		return netip.AddrFrom4(addr)
+	}
+
+	ports := []string{"80", "443", "80,443", "443,80", "1000-2000", "53"}
+	protocols := []string{"tcp", "udp", "all"}
+
+	var rules []policy.SecurityGroupRule
+	for range 1 + random.IntN(6) {
+		var destinations []string
+		for range 1 + random.IntN(4) {
+			switch random.IntN(3) {
+			case 0:
+				destinations = append(destinations, randomAddr().String())
+			case 1:
+				// prefixes are not necessarily canonical
+				destinations = append(destinations, fmt.Sprintf("%s/%d", randomAddr(), 22+random.IntN(11)))
+			default:
+				start, end := randomAddr(), randomAddr()
+				if start.Compare(end) > 0 {
+					start, end = end, start
+				}
+				destinations = append(destinations, fmt.Sprintf("%s-%s", start, end))
+			}
+		}
+		rules = append(rules, policy.SecurityGroupRule{
+			Destination: strings.Join(destinations, ","),
+			Protocol:    protocols[random.IntN(len(protocols))],
+			Ports:       ports[random.IntN(len(ports))],
+		})
+	}
+	return policy.SecurityGroup{Rules: rules}
+}
+
+// asgAllows evaluates the ASG rules directly, without translating them.
+func asgAllows(asg policy.SecurityGroup, addr netip.Addr, p probe) bool {
+	for _, rule := range asg.Rules {
+		if rule.Protocol != "all" && (rule.Protocol != p.protocol || !portsContain(rule.Ports, p.port)) {
+			continue
+		}
+		for destination := range strings.SplitSeq(rule.Destination, ",") {
+			if destinationContains(destination, addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func portsContain(ports string, port int) bool {
+	for entry := range strings.SplitSeq(ports, ",") {
+		first, last, found := strings.Cut(entry, "-")
+		if !found {
+			last = first
+		}
+		start, _ := strconv.Atoi(first)
+		end, _ := strconv.Atoi(last)
+		if start <= port && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+func destinationContains(destination string, addr netip.Addr) bool {
+	if strings.Contains(destination, "/") {
+		return netip.MustParsePrefix(destination).Masked().Contains(addr)
+	}
+	if first, last, found := strings.Cut(destination, "-"); found {
+		return netip.MustParseAddr(first).Compare(addr) <= 0 && addr.Compare(netip.MustParseAddr(last)) <= 0
+	}
+	return netip.MustParseAddr(destination) == addr
+}
+
+// egressAllows evaluates translated Cilium egress rules.
+func egressAllows(rules []ciliumapi.EgressRule, addr netip.Addr, p probe) bool {
+	for _, rule := range rules {
+		if !slices.ContainsFunc(rule.ToCIDR, func(cidr ciliumapi.CIDR) bool {
+			return netip.MustParsePrefix(string(cidr)).Contains(addr)
+		}) {
+			continue
+		}
+		if len(rule.ToPorts) == 0 {
+			return true
+		}
+		for _, portRule := range rule.ToPorts {
+			for _, port := range portRule.Ports {
+				start, _ := strconv.Atoi(port.Port)
+				end := max(int(port.EndPort), start)
+				if strings.EqualFold(string(port.Protocol), p.protocol) && start <= p.port && p.port <= end {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package reconciler
+
+import (
+	"maps"
+	"slices"
+
+	"code.cloudfoundry.org/k8s-policy-agent/internal/types"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Workloads records the spaces and apps which have pods in each workload
+// namespace, so that policies are only rendered into namespaces where they
+// can select pods.
+type Workloads struct {
+	spaces map[string]map[string]struct{}
+	apps   map[string]map[string]struct{}
+}
+
+// NewWorkloads collects the space and app GUIDs of CF pods per namespace.
+func NewWorkloads(pods []corev1.Pod) Workloads {
+	w := Workloads{
+		spaces: map[string]map[string]struct{}{},
+		apps:   map[string]map[string]struct{}{},
+	}
+
+	for _, pod := range pods {
+		if spaceGUID, ok := pod.GetLabels()[types.SpaceGUIDLabelKey]; ok {
+			addToSet(w.spaces, pod.Namespace, spaceGUID)
+		}
+		if appGUID, ok := pod.GetLabels()[types.AppGUIDLabelKey]; ok {
+			addToSet(w.apps, pod.Namespace, appGUID)
+		}
+	}
+
+	return w
+}
+
+// SpaceGUIDs returns the sorted space GUIDs of pods in all namespaces.
+func (w Workloads) SpaceGUIDs() []string {
+	spaceGUIDs := map[string]struct{}{}
+	for _, guids := range w.spaces {
+		maps.Copy(spaceGUIDs, guids)
+	}
+	return slices.Sorted(maps.Keys(spaceGUIDs))
+}
+
+func (w Workloads) Equal(other Workloads) bool {
+	return maps.EqualFunc(w.spaces, other.spaces, maps.Equal) &&
+		maps.EqualFunc(w.apps, other.apps, maps.Equal)
+}
+
+// namespacesHostingSpaces returns the sorted namespaces with pods in any of
+// the given spaces.
+func (w Workloads) namespacesHostingSpaces(spaceGUIDs ...string) []string {
+	return namespacesContaining(w.spaces, spaceGUIDs)
+}
+
+// namespacesHostingApp returns the sorted namespaces with pods of the app.
+func (w Workloads) namespacesHostingApp(appGUID string) []string {
+	return namespacesContaining(w.apps, []string{appGUID})
+}
+
+func namespacesContaining(sets map[string]map[string]struct{}, guids []string) []string {
+	namespaces := []string{}
+	for namespace, set := range sets {
+		if slices.ContainsFunc(guids, func(guid string) bool {
+			_, ok := set[guid]
+			return ok
+		}) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	slices.Sort(namespaces)
+	return namespaces
+}
+
+func addToSet(sets map[string]map[string]struct{}, namespace, guid string) {
+	if _, ok := sets[namespace]; !ok {
+		sets[namespace] = map[string]struct{}{}
+	}
+	sets[namespace][guid] = struct{}{}
+}
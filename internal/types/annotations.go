@@ -0,0 +1,30 @@
+package types
+
+import "fmt"
+
+const (
+	AnnotationPrefix = "policy-agent.cloudfoundry.org/"
+
+	TranslationWarningsAnnotationKey = AnnotationPrefix + "translation-warnings"
+	TranslationErrorsAnnotationKey   = AnnotationPrefix + "translation-errors"
+
+	// RuleNameAnnotationKey holds the full name of ASGs whose names are no
+	// valid label values and are sanitised in the rule-name label.
+	RuleNameAnnotationKey = AnnotationPrefix + "rule-name"
+
+	// SourceHashAnnotationKey holds a hash of the ASG or C2C policies a
+	// policy is rendered from and SpecHashAnnotationKey a hash of its
+	// rendered specs, which tells manual edits of the specs apart.
+	SourceHashAnnotationKey = AnnotationPrefix + "source-hash"
+	SpecHashAnnotationKey   = AnnotationPrefix + "spec-hash"
+
+	// AllowDeletionAnnotationKey is set by operators to delete an obsolete
+	// CiliumNetworkPolicy regardless of the deletion guard.
+	AllowDeletionAnnotationKey = AnnotationPrefix + "allow-deletion"
+)
+
+// RuleDescriptionAnnotationKey returns the annotation key holding the
+// description of the ASG rule at index.
+func RuleDescriptionAnnotationKey(index int) string {
+	return AnnotationPrefix + fmt.Sprintf("rule-%d-description", index)
+}
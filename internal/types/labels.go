@@ -1,7 +1,15 @@
 package types
 
 const (
-	SpaceGUIDLabelKey = "cloudfoundry.org/space-guid"
+	SpaceGUIDLabelKey  = "cloudfoundry.org/space-guid"
+	AppGUIDLabelKey    = "cloudfoundry.org/app-guid"
+	SourceTypeLabelKey = "cloudfoundry.org/source-type"
+
+	SourceTypeStaging = "STG"
+
+	// PodNamespaceLabelKey selects endpoints by namespace in Cilium endpoint
+	// selectors, which otherwise only match the namespace of the policy.
+	PodNamespaceLabelKey = "k8s:io.kubernetes.pod.namespace"
 
 	NetworkPoliciesAppLabelKey   = "app"
 	NetworkPoliciesAppLabelValue = "policy-agent"